@@ -77,14 +77,30 @@ func (t Token) String() string {
 }
 
 func NewLexer(str string) *Lexer {
+	runes := []rune(str)
 	return &Lexer{
-		str:    []rune(str),
-		length: len(str),
+		str:    runes,
+		length: len(runes),
 		i:      -1,
 		status: status0,
 	}
 }
 
+// Pos returns the rune offset at which the next token starts.
+func (l *Lexer) Pos() int {
+	if l.i+1 > l.length {
+		return l.length
+	}
+	return l.i + 1
+}
+
+// Reset returns the lexer to the state it starts in, so that the runes
+// after Pos are read as selectors again even if they follow an unclosed
+// attribute bracket.
+func (l *Lexer) Reset() {
+	l.status = status0
+}
+
 func (l *Lexer) getRune() (rune, error) {
 	l.i++
 	if l.i < l.length {
@@ -156,38 +172,21 @@ func (l *Lexer) NextToken() (token Token, err error) {
 		}
 	case status1:
 		switch c {
+		case ',':
+			token = Token{Type: Comma}
 		case ']':
 			l.status = status0
 			token = Token{Type: RightBracket}
 		// String
-		case '\'':
-			s := []rune{c}
-			for {
-				if c, err = l.getRune(); err != nil {
-					return Token{}, errors.New("Unclosed string: " + string(s))
-				} else if c == '\'' {
-					s = append(s, c)
-					return Token{Type: String, Value: string(s)}, nil
-				} else {
-					s = append(s, c)
-				}
-			}
-		case '"':
-			s := []rune{c}
-			for {
-				if c, err = l.getRune(); err != nil {
-					return Token{}, errors.New("Unclosed string: " + string(s))
-				} else if c == '"' {
-					s = append(s, c)
-					return Token{Type: String, Value: string(s)}, nil
-				} else {
-					s = append(s, c)
-				}
-			}
+		case '\'', '"':
+			return l.quoted(c)
 		default:
+			// A literal ends at a comma too, which is where a forgiving
+			// parse resumes after an unclosed bracket as in "[a=b, .c".
+			// Values holding commas have to be quoted.
 			s := []rune{c}
 			for {
-				if c, err = l.getRune(); err != nil || c == '"' || c == '\'' || c == ']' {
+				if c, err = l.getRune(); err != nil || c == '"' || c == '\'' || c == ']' || c == ',' {
 					l.i--
 					return Token{Type: Literal, Value: string(s)}, nil
 				} else {
@@ -200,3 +199,29 @@ func (l *Lexer) NextToken() (token Token, err error) {
 	}
 	return
 }
+
+// quoted reads a string opened by the quote q. A backslash escapes a quote
+// or another backslash, which stays in the token value; other backslashes
+// are kept as they are.
+func (l *Lexer) quoted(q rune) (Token, error) {
+	s := []rune{q}
+	for {
+		c, err := l.getRune()
+		switch {
+		case err != nil:
+			return Token{}, errors.New("Unclosed string: " + string(s))
+		case c == q:
+			s = append(s, c)
+			return Token{Type: String, Value: string(s)}, nil
+		case c == '\\' && l.i+1 < l.length && isEscaped(l.str[l.i+1]):
+			l.i++
+			s = append(s, c, l.str[l.i])
+		default:
+			s = append(s, c)
+		}
+	}
+}
+
+func isEscaped(c rune) bool {
+	return c == '"' || c == '\'' || c == '\\'
+}
@@ -126,3 +126,33 @@ func Test5(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func Test6(t *testing.T) {
+	if ok, err :=
+		ParseTest(
+			"[a=b, .c",
+			Token{Type: LeftBracket},
+			Token{Type: Identifier, Value: "a"},
+			Token{Type: Assign},
+			Token{Type: Literal, Value: "b"},
+			Token{Type: Comma},
+			Token{Type: Blank},
+			Token{Type: Literal, Value: ".c"},
+			Token{Type: EOF}); !ok {
+		t.Error(err)
+	}
+}
+
+func Test7(t *testing.T) {
+	if ok, err :=
+		ParseTest(
+			`[a="x\"'\\"]`,
+			Token{Type: LeftBracket},
+			Token{Type: Identifier, Value: "a"},
+			Token{Type: Assign},
+			Token{Type: String, Value: `"x\"'\\"`},
+			Token{Type: RightBracket},
+			Token{Type: EOF}); !ok {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,100 @@
+package node
+
+import (
+	"strings"
+)
+
+const bloomBits = 12
+
+// bloom is a counting Bloom filter over the tag names, ids, classes and
+// attribute names of the ancestors of the element being matched, in the
+// manner of WebKit's SelectorFilter. A selector whose ancestor compounds
+// need a key that is not in the filter cannot match, so most candidates
+// are rejected without walking up the tree. Counters saturate instead of
+// wrapping; a saturated counter only makes the filter less selective.
+type bloom struct {
+	counts [1 << bloomBits]uint8
+	// stack holds the hashes pushed for each open ancestor.
+	stack []uint32
+}
+
+// push adds the keys of n and returns how many hashes it added.
+func (b *bloom) push(n *Node) int {
+	k := len(b.stack)
+	b.stack = append(b.stack, hashKey(keyTag, n.Data))
+	for _, attr := range n.Attr {
+		name := strings.ToLower(attr.Key)
+		b.stack = append(b.stack, hashKey(keyAttr, name))
+		switch name {
+		case "id":
+			b.stack = append(b.stack, hashKey(keyId, attr.Val))
+		case "class":
+			s := attr.Val
+			for i := 0; i < len(s); {
+				for i < len(s) && isSpace(s[i]) {
+					i++
+				}
+				j := i
+				for j < len(s) && !isSpace(s[j]) {
+					j++
+				}
+				if j > i {
+					b.stack = append(b.stack, hashKey(keyClass, s[i:j]))
+				}
+				i = j
+			}
+		}
+	}
+	for _, h := range b.stack[k:] {
+		b.inc(h & (1<<bloomBits - 1))
+		b.inc(h >> bloomBits & (1<<bloomBits - 1))
+	}
+	return len(b.stack) - k
+}
+
+// pop removes the last k hashes pushed.
+func (b *bloom) pop(k int) {
+	for _, h := range b.stack[len(b.stack)-k:] {
+		b.dec(h & (1<<bloomBits - 1))
+		b.dec(h >> bloomBits & (1<<bloomBits - 1))
+	}
+	b.stack = b.stack[:len(b.stack)-k]
+}
+
+// mayContain reports whether every hash may have been pushed.
+func (b *bloom) mayContain(hashes []uint32) bool {
+	for _, h := range hashes {
+		if b.counts[h&(1<<bloomBits-1)] == 0 || b.counts[h>>bloomBits&(1<<bloomBits-1)] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloom) inc(i uint32) {
+	if b.counts[i] != 255 {
+		b.counts[i]++
+	}
+}
+
+func (b *bloom) dec(i uint32) {
+	if b.counts[i] != 255 {
+		b.counts[i]--
+	}
+}
+
+// hashKey is FNV-1a over the kind and name. Tag and attribute names are
+// folded to lower case.
+func hashKey(kind int, name string) uint32 {
+	h := uint32(2166136261)
+	h = (h ^ uint32(kind)) * 16777619
+	fold := kind == keyTag || kind == keyAttr
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if fold && 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		h = (h ^ uint32(c)) * 16777619
+	}
+	return h
+}
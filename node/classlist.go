@@ -0,0 +1,160 @@
+package node
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ClassList is a live view of the class attribute of an element, like the
+// DOM's DOMTokenList. Classes are separated by ASCII whitespace, duplicates
+// count once, and every change rewrites the attribute as the remaining
+// classes joined by single spaces. Tokens that are empty or contain
+// whitespace are never valid classes: they are reported absent and
+// ignored by Add, Remove, Toggle and Replace.
+type ClassList struct {
+	n *Node
+}
+
+func (n *Node) ClassList() ClassList {
+	return ClassList{n}
+}
+
+// Values returns the classes in order of first appearance.
+func (l ClassList) Values() []string {
+	val, _ := l.n.lookupAttr("class")
+	return splitClasses(val)
+}
+
+func (l ClassList) Len() int {
+	return len(l.Values())
+}
+
+// Item returns the i-th class, or "" if i is out of range.
+func (l ClassList) Item(i int) string {
+	if values := l.Values(); i >= 0 && i < len(values) {
+		return values[i]
+	}
+	return ""
+}
+
+func (l ClassList) Has(class string) bool {
+	val, ok := l.n.lookupAttr("class")
+	return ok && validClass(class) && containsToken(val, class)
+}
+
+// Contains is Has under its DOM name.
+func (l ClassList) Contains(class string) bool {
+	return l.Has(class)
+}
+
+func (l ClassList) Add(classes ...string) {
+	values := l.Values()
+	for _, c := range classes {
+		if validClass(c) && !contains(values, c) {
+			values = append(values, c)
+		}
+	}
+	l.set(values)
+}
+
+func (l ClassList) Remove(classes ...string) {
+	if _, ok := l.n.lookupAttr("class"); !ok {
+		return
+	}
+	values := []string{}
+	for _, c := range l.Values() {
+		if !contains(classes, c) {
+			values = append(values, c)
+		}
+	}
+	l.set(values)
+}
+
+// Toggle removes class if present and adds it otherwise, and reports
+// whether it is present afterwards.
+func (l ClassList) Toggle(class string) bool {
+	if !validClass(class) {
+		return false
+	}
+	if l.Has(class) {
+		l.Remove(class)
+		return false
+	}
+	l.Add(class)
+	return true
+}
+
+// Replace replaces old with new in place and reports whether old was
+// present.
+func (l ClassList) Replace(old, new string) bool {
+	if !validClass(old) || !validClass(new) || !l.Has(old) {
+		return false
+	}
+	values := []string{}
+	for _, c := range l.Values() {
+		if c == old {
+			c = new
+		}
+		if !contains(values, c) {
+			values = append(values, c)
+		}
+	}
+	l.set(values)
+	return true
+}
+
+func (l ClassList) String() string {
+	return strings.Join(l.Values(), " ")
+}
+
+func (l ClassList) set(values []string) {
+	val := strings.Join(values, " ")
+	for i, attr := range l.n.Attr {
+		if strings.EqualFold(attr.Key, "class") {
+			l.n.Attr[i].Val = val
+			return
+		}
+	}
+	l.n.Attr = append(l.n.Attr, html.Attribute{Key: "class", Val: val})
+}
+
+// splitClasses splits s on ASCII whitespace and drops duplicates.
+func splitClasses(s string) []string {
+	classes := []string{}
+	for i := 0; i < len(s); {
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		j := i
+		for j < len(s) && !isSpace(s[j]) {
+			j++
+		}
+		if j > i && !contains(classes, s[i:j]) {
+			classes = append(classes, s[i:j])
+		}
+		i = j
+	}
+	return classes
+}
+
+func validClass(c string) bool {
+	if c == "" {
+		return false
+	}
+	for i := 0; i < len(c); i++ {
+		if isSpace(c[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
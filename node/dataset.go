@@ -0,0 +1,75 @@
+package node
+
+import (
+	"strings"
+)
+
+// Dataset returns the data-* attributes of n keyed as in the DOM's
+// dataset: "data-product-id" becomes "productId".
+func (n *Node) Dataset() map[string]string {
+	data := map[string]string{}
+	for _, attr := range n.Attr {
+		if key, ok := datasetKey(attr.Key); ok {
+			data[key] = attr.Val
+		}
+	}
+	return data
+}
+
+// GetData returns the data-* attribute for a dataset key, and whether it is
+// present.
+func (n *Node) GetData(key string) (string, bool) {
+	name, ok := dataAttr(key)
+	if !ok {
+		return "", false
+	}
+	for _, attr := range n.Attr {
+		if attr.Key == name {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// datasetKey maps an attribute name to its dataset key: "data-" is dropped
+// and every "-" followed by a lowercase ASCII letter is replaced by the
+// letter in upper case. Names with upper case letters have no key.
+func datasetKey(name string) (string, bool) {
+	if !strings.HasPrefix(name, "data-") {
+		return "", false
+	}
+	name = name[len("data-"):]
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'A' <= c && c <= 'Z' {
+			return "", false
+		}
+		if c == '-' && i+1 < len(name) && 'a' <= name[i+1] && name[i+1] <= 'z' {
+			b.WriteByte(name[i+1] - 'a' + 'A')
+			i++
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), true
+}
+
+// dataAttr is the inverse of datasetKey. Keys with a "-" followed by a
+// lowercase ASCII letter have no attribute.
+func dataAttr(key string) (string, bool) {
+	var b strings.Builder
+	b.WriteString("data-")
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == '-' && i+1 < len(key) && 'a' <= key[i+1] && key[i+1] <= 'z' {
+			return "", false
+		}
+		if 'A' <= c && c <= 'Z' {
+			b.WriteByte('-')
+			c += 'a' - 'A'
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), true
+}
@@ -0,0 +1,196 @@
+package node
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// Index maps ids, classes, tag names and attribute names to the elements
+// of a tree, so that a query can start from the rarest key of its
+// rightmost compound instead of walking every element. The maps are built
+// on first use; call Invalidate after changing the tree.
+type Index struct {
+	root *Node
+	mu   sync.Mutex
+	data *indexData
+}
+
+// indexData is never modified once built, so lookups need no locking.
+type indexData struct {
+	ids, classes, tags, attrs map[string][]*Node
+	// pos is the pre-order position of every node and end the last
+	// position inside its subtree.
+	pos, end map[*Node]int
+}
+
+type indexKey struct {
+	kind int
+	name string
+}
+
+const (
+	keyId = iota
+	keyClass
+	keyTag
+	keyAttr
+)
+
+func NewIndex(root *Node) *Index {
+	return &Index{root: root}
+}
+
+// Root returns the node the index was built for.
+func (x *Index) Root() *Node {
+	return x.root
+}
+
+// Invalidate drops the maps; they are rebuilt by the next lookup.
+func (x *Index) Invalidate() {
+	x.mu.Lock()
+	x.data = nil
+	x.mu.Unlock()
+}
+
+// ById returns the elements with the given id, in document order.
+func (x *Index) ById(id string) []*Node {
+	return x.snapshot().ids[id]
+}
+
+// ByClass returns the elements with the given class, in document order.
+func (x *Index) ByClass(class string) []*Node {
+	return x.snapshot().classes[class]
+}
+
+// ByTag returns the elements with the given tag name, in document order.
+func (x *Index) ByTag(tag string) []*Node {
+	return x.snapshot().tags[strings.ToLower(tag)]
+}
+
+// ByAttr returns the elements that have the named attribute, in document
+// order.
+func (x *Index) ByAttr(name string) []*Node {
+	return x.snapshot().attrs[strings.ToLower(name)]
+}
+
+func (x *Index) snapshot() *indexData {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.data == nil {
+		x.data = &indexData{
+			ids:     map[string][]*Node{},
+			classes: map[string][]*Node{},
+			tags:    map[string][]*Node{},
+			attrs:   map[string][]*Node{},
+			pos:     map[*Node]int{},
+			end:     map[*Node]int{},
+		}
+		x.data.add(x.root)
+	}
+	return x.data
+}
+
+func (d *indexData) add(n *Node) {
+	d.pos[n] = len(d.pos)
+	if n.Type == html.ElementNode {
+		d.tags[strings.ToLower(n.Data)] = append(d.tags[strings.ToLower(n.Data)], n)
+		for _, attr := range n.Attr {
+			name := strings.ToLower(attr.Key)
+			d.attrs[name] = append(d.attrs[name], n)
+			switch name {
+			case "id":
+				d.ids[attr.Val] = append(d.ids[attr.Val], n)
+			case "class":
+				for _, c := range splitClasses(attr.Val) {
+					d.classes[c] = append(d.classes[c], n)
+				}
+			}
+		}
+	}
+	for c := (*Node)(n.FirstChild); c != nil; c = (*Node)(c.NextSibling) {
+		d.add(c)
+	}
+	d.end[n] = len(d.pos) - 1
+}
+
+// candidates returns the shortest list among keys, or false if there are
+// no keys to look up.
+func (d *indexData) candidates(keys []indexKey) ([]*Node, bool) {
+	var best []*Node
+	for i, k := range keys {
+		var list []*Node
+		switch k.kind {
+		case keyId:
+			list = d.ids[k.name]
+		case keyClass:
+			list = d.classes[k.name]
+		case keyTag:
+			list = d.tags[k.name]
+		case keyAttr:
+			list = d.attrs[k.name]
+		}
+		if i == 0 || len(list) < len(best) {
+			best = list
+		}
+	}
+	return best, len(keys) > 0
+}
+
+// inside reports whether n is a strict descendant of root.
+func (d *indexData) inside(root, n *Node) bool {
+	p := d.pos[n]
+	return d.pos[root] < p && p <= d.end[root]
+}
+
+// FindIndexed is Find using idx to pick the candidates for the rightmost
+// compound of each branch. It falls back to walking the roots when a
+// branch has nothing to look up, such as "div > *", when a root is not in
+// the indexed tree, or when the roots are smaller than the candidate set.
+// A nil idx always walks.
+func (q *Query) FindIndexed(idx *Index, roots ...*Node) []*Node {
+	if idx == nil {
+		return q.Find(roots...)
+	}
+	d := idx.snapshot()
+	size := 0
+	for _, root := range roots {
+		if _, ok := d.pos[root]; !ok {
+			return q.Find(roots...)
+		}
+		size += d.end[root] - d.pos[root]
+	}
+	cands := []*Node{}
+	for _, c := range q.branches {
+		list, ok := d.candidates(c.keys)
+		if !ok {
+			return q.Find(roots...)
+		}
+		cands = append(cands, list...)
+	}
+	if size < len(cands) {
+		return q.Find(roots...)
+	}
+	if len(q.branches) > 1 {
+		sort.Slice(cands, func(i, j int) bool { return d.pos[cands[i]] < d.pos[cands[j]] })
+	}
+
+	states := make([]*matchState, len(roots))
+	for i, root := range roots {
+		states[i] = &matchState{scope: root}
+	}
+	nodes := []*Node{}
+	for i, n := range cands {
+		if i > 0 && n == cands[i-1] {
+			continue
+		}
+		for j, root := range roots {
+			if d.inside(root, n) && q.match(n, states[j]) {
+				nodes = append(nodes, n)
+				break
+			}
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,46 @@
+package node
+
+import (
+	"iter"
+)
+
+// Descendants yields the nodes under n in document order, of every type.
+// It walks the tree as it goes, so the tree must not change while the
+// loop runs.
+func (n *Node) Descendants() iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		c := (*Node)(n.FirstChild)
+		for c != nil {
+			if !yield(c) {
+				return
+			}
+			if c.FirstChild != nil {
+				c = (*Node)(c.FirstChild)
+				continue
+			}
+			for c != n && c.NextSibling == nil {
+				c = (*Node)(c.Parent)
+			}
+			if c == n {
+				return
+			}
+			c = (*Node)(c.NextSibling)
+		}
+	}
+}
+
+// Ancestors yields the parent of n, its parent and so on up to the root.
+func (n *Node) Ancestors() iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		for p := (*Node)(n.Parent); p != nil && yield(p); p = (*Node)(p.Parent) {
+		}
+	}
+}
+
+// FollowingSiblings yields the siblings after n, of every type.
+func (n *Node) FollowingSiblings() iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		for s := (*Node)(n.NextSibling); s != nil && yield(s); s = (*Node)(s.NextSibling) {
+		}
+	}
+}
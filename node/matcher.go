@@ -0,0 +1,146 @@
+package node
+
+import (
+	"strings"
+
+	"github.com/SteveZhangBit/leiogo-css/parser"
+	"golang.org/x/net/html"
+)
+
+// Matcher reports whether an element matches a compound selector.
+type Matcher func(n *Node) bool
+
+// Compile lowers query into a Matcher. Tag and attribute names are
+// compared case-insensitively, and the tests run cheapest first: type,
+// id, attribute conditions, then classes, which share a single scan of the
+// class attribute. Attribute operators follow CSS: every operator needs
+// the attribute to be present and ^=, $= and *= never match an empty
+// value. An empty query matches nothing.
+func Compile(query parser.Element) Matcher {
+	var tag, id []Matcher
+	var attrs, values []Matcher
+	var classes []string
+	for _, ast := range query.Seq {
+		switch x := ast.(type) {
+		case parser.Tag:
+			if x.Name != "*" {
+				name := strings.ToLower(x.Name)
+				tag = append(tag, func(n *Node) bool {
+					return n.Data == name || len(n.Data) == len(name) && strings.EqualFold(n.Data, name)
+				})
+			}
+		case parser.Id:
+			name := x.Name
+			id = append(id, func(n *Node) bool {
+				val, ok := n.lookupAttr("id")
+				return ok && val == name
+			})
+		case parser.Class:
+			classes = append(classes, x.Name)
+		case parser.Attr:
+			if x.Type == "" || x.Type == "=" {
+				attrs = append(attrs, attrMatcher(x))
+			} else {
+				values = append(values, attrMatcher(x))
+			}
+		}
+	}
+	if len(query.Seq) == 0 {
+		return func(n *Node) bool { return false }
+	}
+
+	tests := append(append(append(tag, id...), attrs...), values...)
+	if len(classes) > 0 {
+		tests = append(tests, func(n *Node) bool {
+			val, ok := n.lookupAttr("class")
+			if !ok {
+				return false
+			}
+			for _, c := range classes {
+				if !containsToken(val, c) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	return func(n *Node) bool {
+		if n.Type != html.ElementNode {
+			return false
+		}
+		for _, test := range tests {
+			if !test(n) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func attrMatcher(a parser.Attr) Matcher {
+	name, val := strings.ToLower(a.Name), a.Value
+	var op func(string) bool
+	switch a.Type {
+	case "":
+		op = func(string) bool { return true }
+	case "=":
+		op = func(s string) bool { return s == val }
+	case "^=":
+		op = func(s string) bool { return val != "" && strings.HasPrefix(s, val) }
+	case "$=":
+		op = func(s string) bool { return val != "" && strings.HasSuffix(s, val) }
+	case "*=":
+		op = func(s string) bool { return val != "" && strings.Contains(s, val) }
+	default:
+		op = func(string) bool { return false }
+	}
+	return func(n *Node) bool {
+		s, ok := n.lookupAttr(name)
+		return ok && op(s)
+	}
+}
+
+// lookupAttr finds an attribute by its lowercase name.
+func (n *Node) lookupAttr(name string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == name || len(attr.Key) == len(name) && strings.EqualFold(attr.Key, name) {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// all matches every element; traversals use it for an empty query.
+func all(n *Node) bool {
+	return n.Type == html.ElementNode
+}
+
+func filter(query parser.Element) Matcher {
+	if len(query.Seq) == 0 {
+		return all
+	}
+	return Compile(query)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+// containsToken reports whether the whitespace separated list s contains
+// tok, without allocating.
+func containsToken(s, tok string) bool {
+	for i := 0; i < len(s); {
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		j := i
+		for j < len(s) && !isSpace(s[j]) {
+			j++
+		}
+		if j > i && s[i:j] == tok {
+			return true
+		}
+		i = j
+	}
+	return false
+}
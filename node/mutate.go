@@ -0,0 +1,112 @@
+package node
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// SetAttr sets the attribute name, matched case-insensitively, to val.
+func (n *Node) SetAttr(name, val string) {
+	for i, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, name) {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: name, Val: val})
+}
+
+// RemoveAttr removes the attribute name, matched case-insensitively.
+func (n *Node) RemoveAttr(name string) {
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		if !strings.EqualFold(attr.Key, name) {
+			attrs = append(attrs, attr)
+		}
+	}
+	n.Attr = attrs
+}
+
+// Detach removes n from its parent. It does nothing if n has no parent.
+func (n *Node) Detach() {
+	p := n.Parent
+	if p == nil {
+		return
+	}
+	if n.PrevSibling != nil {
+		n.PrevSibling.NextSibling = n.NextSibling
+	} else if p.FirstChild == (*html.Node)(n) {
+		p.FirstChild = n.NextSibling
+	}
+	if n.NextSibling != nil {
+		n.NextSibling.PrevSibling = n.PrevSibling
+	} else if p.LastChild == (*html.Node)(n) {
+		p.LastChild = n.PrevSibling
+	}
+	n.Parent, n.PrevSibling, n.NextSibling = nil, nil, nil
+}
+
+// InsertBefore detaches c and inserts it as a child of n before ref, or
+// last if ref is nil.
+func (n *Node) InsertBefore(c, ref *Node) {
+	c.Detach()
+	(*html.Node)(n).InsertBefore((*html.Node)(c), (*html.Node)(ref))
+}
+
+// AppendChild detaches c and adds it as the last child of n.
+func (n *Node) AppendChild(c *Node) {
+	n.InsertBefore(c, nil)
+}
+
+// Empty removes every child of n.
+func (n *Node) Empty() {
+	for c := (*Node)(n.FirstChild); c != nil; c = (*Node)(n.FirstChild) {
+		c.Detach()
+	}
+}
+
+// Contains reports whether c is n or one of its descendants.
+func (n *Node) Contains(c *Node) bool {
+	for ; c != nil; c = (*Node)(c.Parent) {
+		if c == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Clone returns a deep copy of n without a parent.
+func (n *Node) Clone() *Node {
+	c := &Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      append([]html.Attribute(nil), n.Attr...),
+	}
+	for child := (*Node)(n.FirstChild); child != nil; child = (*Node)(child.NextSibling) {
+		c.AppendChild(child.Clone())
+	}
+	return c
+}
+
+// ParseFragment parses s as the contents of context, which decides how
+// tags such as tr or option are treated. A nil context, or one that is not
+// an element, parses s as the contents of a body.
+func ParseFragment(s string, context *Node) ([]*Node, error) {
+	ctx := (*html.Node)(context)
+	if context == nil || context.Type != html.ElementNode {
+		ctx = &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	}
+	nodes, err := html.ParseFragment(strings.NewReader(s), ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Node, len(nodes))
+	for i, n := range nodes {
+		out[i] = (*Node)(n)
+	}
+	return out, nil
+}
@@ -1,8 +1,6 @@
 package node
 
 import (
-	"strings"
-
 	"github.com/SteveZhangBit/leiogo-css/parser"
 	"golang.org/x/net/html"
 )
@@ -10,22 +8,26 @@ import (
 type Node html.Node
 
 func Find(n *Node, query parser.Element) []*Node {
-	nodes := []*Node{}
+	return find(n, Compile(query), []*Node{})
+}
+
+func find(n *Node, m Matcher, nodes []*Node) []*Node {
 	for c := (*Node)(n.FirstChild); c != nil; c = (*Node)(c.NextSibling) {
 		if c.Type == html.ElementNode {
-			if c.IsMatch(query) {
+			if m(c) {
 				nodes = append(nodes, c)
 			}
-			nodes = append(nodes, Find(c, query)...)
+			nodes = find(c, m, nodes)
 		}
 	}
 	return nodes
 }
 
 func Child(n *Node, query parser.Element) []*Node {
+	m := filter(query)
 	nodes := []*Node{}
 	for c := (*Node)(n.FirstChild); c != nil; c = (*Node)(c.NextSibling) {
-		if c.Type == html.ElementNode && (len(query.Seq) == 0 || c.IsMatch(query)) {
+		if m(c) {
 			nodes = append(nodes, c)
 		}
 	}
@@ -33,9 +35,10 @@ func Child(n *Node, query parser.Element) []*Node {
 }
 
 func Not(n *Node, query parser.Element) []*Node {
+	m := Compile(query)
 	nodes := []*Node{}
 	for c := (*Node)(n.FirstChild); c != nil; c = (*Node)(c.NextSibling) {
-		if c.Type == html.ElementNode && !c.IsMatch(query) {
+		if c.Type == html.ElementNode && !m(c) {
 			nodes = append(nodes, c)
 		}
 	}
@@ -43,10 +46,11 @@ func Not(n *Node, query parser.Element) []*Node {
 }
 
 func Next(n *Node, query parser.Element) []*Node {
+	m := filter(query)
 	nodes := []*Node{}
 	for s := (*Node)(n.NextSibling); s != nil; s = (*Node)(s.NextSibling) {
 		if s.Type == html.ElementNode {
-			if len(query.Seq) == 0 || s.IsMatch(query) {
+			if m(s) {
 				return append(nodes, s)
 			} else {
 				return nodes
@@ -57,9 +61,10 @@ func Next(n *Node, query parser.Element) []*Node {
 }
 
 func NextAll(n *Node, query parser.Element) []*Node {
+	m := filter(query)
 	nodes := []*Node{}
 	for s := (*Node)(n.NextSibling); s != nil; s = (*Node)(s.NextSibling) {
-		if s.Type == html.ElementNode && (len(query.Seq) == 0 || s.IsMatch(query)) {
+		if m(s) {
 			nodes = append(nodes, s)
 		}
 	}
@@ -67,10 +72,11 @@ func NextAll(n *Node, query parser.Element) []*Node {
 }
 
 func Prev(n *Node, query parser.Element) []*Node {
+	m := filter(query)
 	nodes := []*Node{}
 	for s := (*Node)(n.PrevSibling); s != nil; s = (*Node)(s.PrevSibling) {
 		if s.Type == html.ElementNode {
-			if len(query.Seq) == 0 || s.IsMatch(query) {
+			if m(s) {
 				return append(nodes, s)
 			} else {
 				return nodes
@@ -81,9 +87,10 @@ func Prev(n *Node, query parser.Element) []*Node {
 }
 
 func PrevAll(n *Node, query parser.Element) []*Node {
+	m := filter(query)
 	nodes := []*Node{}
 	for s := (*Node)(n.PrevSibling); s != nil; s = (*Node)(s.PrevSibling) {
-		if s.Type == html.ElementNode && (len(query.Seq) == 0 || s.IsMatch(query)) {
+		if m(s) {
 			nodes = append(nodes, s)
 		}
 	}
@@ -91,9 +98,10 @@ func PrevAll(n *Node, query parser.Element) []*Node {
 }
 
 func Parent(n *Node, query parser.Element) []*Node {
+	m := filter(query)
 	nodes := []*Node{}
 	if s := (*Node)(n.Parent); s != nil {
-		if s.Type == html.ElementNode && (len(query.Seq) == 0 || s.IsMatch(query)) {
+		if m(s) {
 			return append(nodes, s)
 		}
 	}
@@ -101,60 +109,20 @@ func Parent(n *Node, query parser.Element) []*Node {
 }
 
 func Parents(n *Node, query parser.Element) []*Node {
+	m := filter(query)
 	nodes := []*Node{}
 	for s := (*Node)(n.Parent); s != nil; s = (*Node)(s.Parent) {
-		if s.Type == html.ElementNode && (len(query.Seq) == 0 || s.IsMatch(query)) {
+		if m(s) {
 			nodes = append(nodes, s)
 		}
 	}
 	return nodes
 }
 
-func (n *Node) IsMatch(query parser.Element) (isMatch bool) {
-	for _, ast := range query.Seq {
-		switch x := ast.(type) {
-		case parser.Tag:
-			if isMatch = (x.Name == "*" || n.Data == x.Name); !isMatch {
-				break
-			}
-		case parser.Id:
-			if isMatch = n.GetId() == x.Name; !isMatch {
-				break
-			}
-		case parser.Class:
-			isMatch = false
-			for _, c := range n.GetCls() {
-				if c == x.Name {
-					isMatch = true
-					break
-				}
-			}
-		case parser.Attr:
-			switch x.Type {
-			case "":
-				if isMatch = n.HasAttr(x.Name); !isMatch {
-					break
-				}
-			case "=":
-				if isMatch = x.Value == n.GetAttr(x.Name); !isMatch {
-					break
-				}
-			case "^=":
-				if isMatch = strings.HasPrefix(n.GetAttr(x.Name), x.Value); !isMatch {
-					break
-				}
-			case "$=":
-				if isMatch = strings.HasSuffix(n.GetAttr(x.Name), x.Value); !isMatch {
-					break
-				}
-			case "*=":
-				if isMatch = strings.Contains(n.GetAttr(x.Name), x.Value); !isMatch {
-					break
-				}
-			}
-		}
-	}
-	return
+// IsMatch compiles query for a single test. Code that tests many nodes
+// against the same query should keep the Matcher from Compile instead.
+func (n *Node) IsMatch(query parser.Element) bool {
+	return Compile(query)(n)
 }
 
 func (n *Node) GetId() string {
@@ -167,10 +135,8 @@ func (n *Node) GetId() string {
 }
 
 func (n *Node) GetCls() []string {
-	for _, attr := range n.Attr {
-		if attr.Key == "class" {
-			return strings.Split(attr.Val, " ")
-		}
+	if val, ok := n.lookupAttr("class"); ok {
+		return splitClasses(val)
 	}
 	return nil
 }
@@ -193,14 +159,8 @@ func (n *Node) GetAttr(name string) string {
 	return ""
 }
 
+// Text concatenates every text node under n. See TextWith for other ways
+// of extracting text.
 func (n *Node) Text() string {
-	s := ""
-	for c := (*Node)(n.FirstChild); c != nil; c = (*Node)(c.NextSibling) {
-		if c.Type == html.TextNode {
-			s += c.Data
-		} else if c.Type == html.ElementNode {
-			s += c.Text()
-		}
-	}
-	return s
+	return n.TextWith(TextOptions{})
 }
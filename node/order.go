@@ -0,0 +1,196 @@
+package node
+
+import (
+	"sort"
+
+	"golang.org/x/net/html"
+)
+
+// Compare reports the document order of a and b: -1 if a comes first, 1 if
+// b comes first and 0 if they are the same node or live in different trees.
+// Attribute nodes come right after their owner, in the order of its
+// attributes, and before its children.
+func Compare(a, b *Node) int {
+	oa, ia := owner(a)
+	ob, ib := owner(b)
+	if oa == ob {
+		switch {
+		case ia < ib:
+			return -1
+		case ia > ib:
+			return 1
+		}
+		return 0
+	}
+
+	da, db := depth(oa), depth(ob)
+	pa, pb := oa, ob
+	for ; da > db; da-- {
+		pa = (*Node)(pa.Parent)
+	}
+	for ; db > da; db-- {
+		pb = (*Node)(pb.Parent)
+	}
+	if pa == pb {
+		// One owner is an ancestor of the other, and comes first.
+		if pa == oa {
+			return -1
+		}
+		return 1
+	}
+	for pa.Parent != pb.Parent {
+		pa, pb = (*Node)(pa.Parent), (*Node)(pb.Parent)
+	}
+	if pa.Parent == nil {
+		return 0
+	}
+	for s := pa; s != nil; s = (*Node)(s.NextSibling) {
+		if s == pb {
+			return -1
+		}
+	}
+	return 1
+}
+
+// SortUnique sorts nodes in document order and removes duplicates. The
+// slice is modified in place. Positions are found with one walk of the
+// trees the nodes belong to, so nodes from different trees keep the order
+// in which their trees first appear.
+func SortUnique(nodes []*Node) []*Node {
+	if len(nodes) < 2 {
+		return nodes
+	}
+	pos := positions(nodes)
+	less := func(a, b *Node) bool {
+		oa, ia := owner(a)
+		ob, ib := owner(b)
+		if pa, pb := pos[oa], pos[ob]; pa != pb {
+			return pa < pb
+		}
+		return ia < ib
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return less(nodes[i], nodes[j])
+	})
+	out := nodes[:0]
+	for i, n := range nodes {
+		if i == 0 || !same(n, nodes[i-1]) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// positions numbers the owners of nodes in pre-order. The walk of a tree
+// stops as soon as every owner in it has its number.
+func positions(nodes []*Node) map[*Node]int {
+	pos := make(map[*Node]int, len(nodes))
+	var roots []*Node
+	seen := map[*Node]bool{}
+	for _, n := range nodes {
+		o, _ := owner(n)
+		if _, ok := pos[o]; ok {
+			continue
+		}
+		pos[o] = -1
+		r := o
+		for r.Parent != nil {
+			r = (*Node)(r.Parent)
+		}
+		if !seen[r] {
+			seen[r] = true
+			roots = append(roots, r)
+		}
+	}
+	left, k := len(pos), 0
+	for _, r := range roots {
+		for n := r; left > 0; {
+			if p, ok := pos[n]; ok && p < 0 {
+				pos[n] = k
+				left--
+			}
+			k++
+			if c := (*Node)(n.FirstChild); c != nil {
+				n = c
+				continue
+			}
+			for n != r && n.NextSibling == nil {
+				n = (*Node)(n.Parent)
+			}
+			if n == r {
+				break
+			}
+			n = (*Node)(n.NextSibling)
+		}
+	}
+	return pos
+}
+
+// AttrNode returns a node standing for the i-th attribute of owner, as
+// attributes are not part of the document tree. It is a text node holding
+// the attribute value, with owner as Parent but not among its children,
+// and the attribute itself as its only Attr. Compare and SortUnique treat
+// two such nodes for the same attribute as the same node.
+func AttrNode(owner *Node, i int) *Node {
+	return &Node{
+		Type:   html.TextNode,
+		Data:   owner.Attr[i].Val,
+		Parent: (*html.Node)(owner),
+		Attr:   []html.Attribute{owner.Attr[i]},
+	}
+}
+
+// attrIndex returns the attribute of its Parent that n stands for, or -1
+// if n is not an attribute node.
+func attrIndex(n *Node) int {
+	p := (*Node)(n.Parent)
+	if n.Type != html.TextNode || p == nil || len(n.Attr) != 1 || n.PrevSibling != nil || p.FirstChild == (*html.Node)(n) {
+		return -1
+	}
+	for i, attr := range p.Attr {
+		if attr.Key == n.Attr[0].Key && attr.Namespace == n.Attr[0].Namespace {
+			return i
+		}
+	}
+	return -1
+}
+
+// owner returns the tree node that places n in document order, and the
+// attribute n stands for, or -1.
+func owner(n *Node) (*Node, int) {
+	if i := attrIndex(n); i >= 0 {
+		return (*Node)(n.Parent), i
+	}
+	return n, -1
+}
+
+// Identity tells nodes apart the way SortUnique does. Nodes have the same
+// Identity if they are the same node, or attribute nodes standing for the
+// same attribute.
+type Identity struct {
+	node *Node
+	attr int
+}
+
+// Identity returns the identity of n, to key maps of nodes with.
+func (n *Node) Identity() Identity {
+	o, i := owner(n)
+	if i < 0 {
+		return Identity{n, -1}
+	}
+	return Identity{o, i}
+}
+
+// same reports whether a and b are the same node, or stand for the same
+// attribute.
+func same(a, b *Node) bool {
+	return a == b || a.Identity() == b.Identity()
+}
+
+func depth(n *Node) int {
+	d := 0
+	for ; n != nil; n = (*Node)(n.Parent) {
+		d++
+	}
+	return d
+}
@@ -0,0 +1,279 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SteveZhangBit/leiogo-css/parser"
+	"golang.org/x/net/html"
+)
+
+// Query is a compiled selector list. Like a browser, it matches right to
+// left: an element is a candidate if it matches the rightmost compound,
+// and the combinators are then verified by walking up and back from it.
+type Query struct {
+	branches []*complexMatcher
+}
+
+// complexMatcher is one complex selector: compounds joined by ops, left to
+// right.
+type complexMatcher struct {
+	compounds []Matcher
+	ops       []string
+	// keys are the index lookups the rightmost compound requires.
+	keys []indexKey
+	// ancestors are the hashes of the keys that compounds followed by " "
+	// or ">" require. Those compounds always match ancestors of the
+	// subject, even behind a sibling combinator.
+	ancestors []uint32
+}
+
+func NewQuery(ast parser.AST) (*Query, error) {
+	q := &Query{}
+	if x, ok := ast.(parser.Selector); ok {
+		for _, exp := range x.Seq {
+			c, err := newComplex(exp)
+			if err != nil {
+				return nil, err
+			}
+			q.branches = append(q.branches, c)
+		}
+		return q, nil
+	}
+	c, err := newComplex(ast)
+	if err != nil {
+		return nil, err
+	}
+	q.branches = append(q.branches, c)
+	return q, nil
+}
+
+func newComplex(ast parser.AST) (*complexMatcher, error) {
+	switch x := ast.(type) {
+	case parser.Element:
+		return &complexMatcher{compounds: []Matcher{Compile(x)}, keys: keysOf(x)}, nil
+	case parser.Exp:
+		c, err := newComplex(x.E)
+		if err != nil {
+			return nil, err
+		}
+		el, ok := x.F.(parser.Element)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Unsupported selector: %T on the right of %q", x.F, x.Op))
+		}
+		if len(el.Seq) == 0 || empty(x.E) {
+			return nil, errors.New(fmt.Sprintf("Missing compound selector next to %q", x.Op))
+		}
+		switch x.Op {
+		case " ", ">", "+", "~":
+		default:
+			return nil, errors.New("Unsupported combinator: " + x.Op)
+		}
+		c.compounds = append(c.compounds, Compile(el))
+		if x.Op == " " || x.Op == ">" {
+			for _, k := range c.keys {
+				c.ancestors = append(c.ancestors, hashKey(k.kind, k.name))
+			}
+		}
+		c.ops = append(c.ops, x.Op)
+		c.keys = keysOf(el)
+		return c, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported selector: %T", ast))
+}
+
+func empty(ast parser.AST) bool {
+	el, ok := ast.(parser.Element)
+	return ok && len(el.Seq) == 0
+}
+
+func keysOf(el parser.Element) []indexKey {
+	keys := []indexKey{}
+	for _, ast := range el.Seq {
+		switch x := ast.(type) {
+		case parser.Tag:
+			if x.Name != "*" {
+				keys = append(keys, indexKey{keyTag, strings.ToLower(x.Name)})
+			}
+		case parser.Id:
+			keys = append(keys, indexKey{keyId, x.Name})
+		case parser.Class:
+			keys = append(keys, indexKey{keyClass, x.Name})
+		case parser.Attr:
+			keys = append(keys, indexKey{keyAttr, strings.ToLower(x.Name)})
+		}
+	}
+	return keys
+}
+
+// Match reports whether n matches the query. Elements that the combinators
+// reach must be descendants of scope; a nil scope means the whole tree.
+func (q *Query) Match(n, scope *Node) bool {
+	return q.match(n, &matchState{scope: scope})
+}
+
+// Find returns the descendants of roots that match the query, each node
+// once and in document order. Every match is scoped to the root it was
+// found under, as if the query was run on each root separately.
+func (q *Query) Find(roots ...*Node) []*Node {
+	nodes := []*Node{}
+	st := q.state(nil)
+	for _, root := range roots {
+		st.scope, st.memo = root, nil
+		nodes = q.find(root, st, nodes, 0)
+	}
+	if len(roots) > 1 {
+		nodes = SortUnique(nodes)
+	}
+	return nodes
+}
+
+// Exists reports whether any descendant of root matches the query, with
+// the scoping of Find. It stops at the first match.
+func (q *Query) Exists(root *Node) bool {
+	return len(q.find(root, q.state(root), nil, 1)) > 0
+}
+
+func (q *Query) state(scope *Node) *matchState {
+	st := &matchState{scope: scope}
+	for _, c := range q.branches {
+		if len(c.ancestors) > 0 {
+			st.bloom = &bloom{}
+			break
+		}
+	}
+	return st
+}
+
+// find appends the matches under n to nodes, stopping once nodes holds
+// limit matches if limit is positive.
+func (q *Query) find(n *Node, st *matchState, nodes []*Node, limit int) []*Node {
+	for c := (*Node)(n.FirstChild); c != nil; c = (*Node)(c.NextSibling) {
+		if limit > 0 && len(nodes) >= limit {
+			break
+		}
+		if c.Type == html.ElementNode {
+			if q.match(c, st) {
+				nodes = append(nodes, c)
+			}
+			if c.FirstChild == nil {
+				continue
+			}
+			if st.bloom != nil {
+				k := st.bloom.push(c)
+				nodes = q.find(c, st, nodes, limit)
+				st.bloom.pop(k)
+			} else {
+				nodes = q.find(c, st, nodes, limit)
+			}
+		}
+	}
+	return nodes
+}
+
+// matchState is shared by the candidates of one Find under one scope. The
+// bloom filter, if any, holds the ancestors of the current candidate up to
+// the scope, and memo caches partial results of a branch for a node: keys
+// with i >= 0 say whether compounds 0..i match with n as compound i, and
+// negative keys hold matchAncestor and matchSibling answers. With them a
+// Find tests every (node, compound) pair at most a constant number of
+// times, however deep the tree.
+type matchState struct {
+	scope *Node
+	bloom *bloom
+	memo  map[memoKey]bool
+}
+
+type memoKey struct {
+	c *complexMatcher
+	i int
+	n *Node
+}
+
+func (q *Query) match(n *Node, st *matchState) bool {
+	for _, c := range q.branches {
+		if st.bloom != nil && !st.bloom.mayContain(c.ancestors) {
+			continue
+		}
+		if c.matchAt(len(c.compounds)-1, n, st) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *complexMatcher) matchAt(i int, n *Node, st *matchState) bool {
+	if !c.compounds[i](n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	if i == len(c.compounds)-1 {
+		return c.matchLeft(i, n, st)
+	}
+	return c.memoize(memoKey{c, i, n}, st, func() bool {
+		return c.matchLeft(i, n, st)
+	})
+}
+
+// matchLeft matches the compounds left of i, given that n matches i.
+func (c *complexMatcher) matchLeft(i int, n *Node, st *matchState) bool {
+	switch c.ops[i-1] {
+	case " ":
+		return c.matchAncestor(i-1, (*Node)(n.Parent), st)
+	case ">":
+		p := (*Node)(n.Parent)
+		return p != nil && p != st.scope && c.matchAt(i-1, p, st)
+	case "+":
+		s := prevElement(n)
+		return s != nil && c.matchAt(i-1, s, st)
+	case "~":
+		return c.matchSibling(i-1, prevElement(n), st)
+	}
+	return false
+}
+
+// matchAncestor reports whether n or one of its ancestors below the scope
+// matches compound i. The answer for n is the answer for its parent unless
+// n itself matches, so every node is tested once per compound.
+func (c *complexMatcher) matchAncestor(i int, n *Node, st *matchState) bool {
+	if n == nil || n == st.scope {
+		return false
+	}
+	return c.memoize(memoKey{c, -1 - i, n}, st, func() bool {
+		return c.matchAt(i, n, st) || c.matchAncestor(i, (*Node)(n.Parent), st)
+	})
+}
+
+// matchSibling is matchAncestor over n and its previous element siblings.
+func (c *complexMatcher) matchSibling(i int, n *Node, st *matchState) bool {
+	if n == nil {
+		return false
+	}
+	return c.memoize(memoKey{c, -1 - len(c.compounds) - i, n}, st, func() bool {
+		return c.matchAt(i, n, st) || c.matchSibling(i, prevElement(n), st)
+	})
+}
+
+func (c *complexMatcher) memoize(k memoKey, st *matchState, f func() bool) bool {
+	if v, ok := st.memo[k]; ok {
+		return v
+	}
+	if st.memo == nil {
+		st.memo = map[memoKey]bool{}
+	}
+	v := f()
+	st.memo[k] = v
+	return v
+}
+
+func prevElement(n *Node) *Node {
+	for s := (*Node)(n.PrevSibling); s != nil; s = (*Node)(s.PrevSibling) {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
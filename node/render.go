@@ -0,0 +1,182 @@
+package node
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// RenderOptions selects how HTML is serialized. The zero value renders
+// exactly what html.Render does.
+type RenderOptions struct {
+	// Indent, if not empty, puts every element, comment and piece of text on
+	// its own line, indented by Indent once per level. Text is trimmed and
+	// whitespace-only text is dropped, so this is meant for reading, not
+	// for round trips. An element whose only child is text stays on one
+	// line.
+	Indent string
+	// Minify drops comments, collapses runs of whitespace in text into one
+	// space and drops whitespace-only text between block level elements.
+	// Indent is ignored.
+	Minify bool
+}
+
+// rawElements keep their contents verbatim: their text is not escaped or
+// it is whitespace sensitive.
+var rawElements = map[string]bool{
+	"iframe": true, "noembed": true, "noframes": true, "noscript": true, "plaintext": true,
+	"pre": true, "script": true, "style": true, "textarea": true, "xmp": true, "listing": true,
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true,
+	"img": true, "input": true, "keygen": true, "link": true, "meta": true, "param": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// Html returns the inner HTML of n.
+func (n *Node) Html() string {
+	var b strings.Builder
+	n.RenderChildren(&b, RenderOptions{})
+	return b.String()
+}
+
+// OuterHtml returns the HTML of n itself.
+func (n *Node) OuterHtml() string {
+	var b strings.Builder
+	n.Render(&b, RenderOptions{})
+	return b.String()
+}
+
+// Render writes the HTML of n to w.
+func (n *Node) Render(w io.Writer, opts RenderOptions) error {
+	r := &renderer{w: w, opts: opts}
+	r.node(n, 0)
+	return r.err
+}
+
+// RenderChildren writes the inner HTML of n to w.
+func (n *Node) RenderChildren(w io.Writer, opts RenderOptions) error {
+	r := &renderer{w: w, opts: opts}
+	r.children(n, 0)
+	return r.err
+}
+
+type renderer struct {
+	w    io.Writer
+	opts RenderOptions
+	err  error
+	// wrote is set once a line has been started in indent mode.
+	wrote bool
+}
+
+func (r *renderer) children(n *Node, depth int) {
+	literal := n.Type == html.ElementNode && rawElements[n.Data] && n.Data != "pre" && n.Data != "textarea" && n.Data != "listing"
+	for c := (*Node)(n.FirstChild); c != nil; c = (*Node)(c.NextSibling) {
+		if literal && c.Type == html.TextNode {
+			r.write(c.Data)
+		} else {
+			r.node(c, depth)
+		}
+	}
+}
+
+func (r *renderer) node(n *Node, depth int) {
+	if r.err != nil {
+		return
+	}
+	plain := r.opts.Indent == "" && !r.opts.Minify
+	switch {
+	case plain:
+		r.err = html.Render(r.w, (*html.Node)(n))
+	case n.Type == html.DocumentNode:
+		r.children(n, depth)
+	case n.Type == html.TextNode:
+		r.text(n, depth)
+	case n.Type == html.CommentNode && r.opts.Minify:
+	case n.Type == html.ElementNode && !rawElements[n.Data]:
+		r.element(n, depth)
+	default:
+		r.line(depth)
+		if r.err == nil {
+			r.err = html.Render(r.w, (*html.Node)(n))
+		}
+	}
+}
+
+func (r *renderer) element(n *Node, depth int) {
+	r.line(depth)
+	r.write("<" + n.Data)
+	for _, attr := range n.Attr {
+		key := attr.Key
+		if attr.Namespace != "" {
+			key = attr.Namespace + ":" + key
+		}
+		r.write(" " + key + `="` + html.EscapeString(attr.Val) + `"`)
+	}
+	if voidElements[n.Data] {
+		r.write("/>")
+		return
+	}
+	r.write(">")
+	if c := n.FirstChild; c != nil && (c.NextSibling != nil || c.Type != html.TextNode) {
+		r.children(n, depth+1)
+		r.line(depth)
+	} else if c != nil && r.opts.Minify {
+		r.text((*Node)(c), depth+1)
+	} else if c != nil {
+		r.write(html.EscapeString(strings.TrimSpace(c.Data)))
+	}
+	r.write("</" + n.Data + ">")
+}
+
+func (r *renderer) text(n *Node, depth int) {
+	if !r.opts.Minify {
+		if s := strings.TrimSpace(n.Data); s != "" {
+			r.line(depth)
+			r.write(html.EscapeString(s))
+		}
+		return
+	}
+	s := strings.Join(strings.FieldsFunc(n.Data, func(c rune) bool {
+		return c < 0x80 && isSpace(byte(c))
+	}), " ")
+	if s == "" {
+		if block((*Node)(n.PrevSibling)) && block((*Node)(n.NextSibling)) {
+			return
+		}
+		r.write(" ")
+		return
+	}
+	if isSpace(n.Data[0]) {
+		s = " " + s
+	}
+	if isSpace(n.Data[len(n.Data)-1]) {
+		s += " "
+	}
+	r.write(html.EscapeString(s))
+}
+
+// block reports whether whitespace next to n is insignificant.
+func block(n *Node) bool {
+	return n == nil || n.Type != html.ElementNode && n.Type != html.TextNode || n.Type == html.ElementNode && blockElements[n.Data]
+}
+
+// line starts a new indented line in indent mode.
+func (r *renderer) line(depth int) {
+	if r.opts.Minify {
+		return
+	}
+	if r.wrote {
+		r.write("\n")
+	}
+	r.write(strings.Repeat(r.opts.Indent, depth))
+	r.wrote = true
+}
+
+func (r *renderer) write(s string) {
+	if r.err == nil {
+		_, r.err = io.WriteString(r.w, s)
+	}
+}
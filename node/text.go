@@ -0,0 +1,186 @@
+package node
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// TextOptions selects how the text of a subtree is extracted. The zero
+// value concatenates every text node, like Text.
+type TextOptions struct {
+	// SkipHidden skips the contents of elements that are never rendered:
+	// head, script, style, template, noscript and the like. The node the
+	// text is taken from is always used, so a title still has text.
+	SkipHidden bool
+	// Collapse turns every run of whitespace into a single space and
+	// trims the result, except inside pre, textarea and listing.
+	Collapse bool
+	// Blocks puts a line break between block level elements such as p,
+	// div and li and for every br, and a space between table cells.
+	Blocks bool
+	// Own only uses the text nodes directly under the node, and br
+	// elements if Blocks is set.
+	Own bool
+}
+
+// InnerText approximates the DOM's innerText for HTML without CSS.
+var InnerText = TextOptions{SkipHidden: true, Collapse: true, Blocks: true}
+
+var hiddenElements = map[string]bool{
+	"head": true, "script": true, "style": true, "template": true, "noscript": true,
+	"title": true, "iframe": true, "object": true, "embed": true, "noembed": true, "noframes": true,
+}
+
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "body": true,
+	"caption": true, "dd": true, "details": true, "dialog": true, "div": true, "dl": true,
+	"dt": true, "fieldset": true, "figcaption": true, "figure": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hgroup": true, "hr": true, "html": true, "legend": true, "li": true,
+	"main": true, "menu": true, "nav": true, "ol": true, "p": true, "pre": true,
+	"section": true, "summary": true, "table": true, "tbody": true, "tfoot": true,
+	"thead": true, "tr": true, "ul": true,
+}
+
+var preElements = map[string]bool{"pre": true, "textarea": true, "listing": true}
+
+// TextWith returns the text of n extracted according to opts.
+func (n *Node) TextWith(opts TextOptions) string {
+	var b strings.Builder
+	n.WriteText(&b, opts)
+	return b.String()
+}
+
+// WriteText streams the text of n extracted according to opts to w, and
+// returns the first write error.
+func (n *Node) WriteText(w io.Writer, opts TextOptions) error {
+	t := &textWriter{w: w, opts: opts}
+	if n.Type == html.TextNode {
+		t.text(n.Data)
+	} else if opts.Own {
+		for c := (*Node)(n.FirstChild); c != nil; c = (*Node)(c.NextSibling) {
+			if c.Type == html.TextNode {
+				t.text(c.Data)
+			} else if c.Type == html.ElementNode && c.Data == "br" && opts.Blocks {
+				t.breaks++
+			}
+		}
+	} else {
+		t.node(n, true)
+	}
+	return t.err
+}
+
+// textWriter holds back separators until the next text, so that nothing
+// is written for empty blocks and there are no trailing separators.
+type textWriter struct {
+	w    io.Writer
+	opts TextOptions
+	err  error
+	// wrote is set once any text has been written.
+	wrote bool
+	// breaks and space are the pending line breaks and space.
+	breaks int
+	space  bool
+	// pre counts the open elements that keep their whitespace.
+	pre int
+}
+
+func (t *textWriter) node(n *Node, root bool) {
+	switch n.Type {
+	case html.TextNode:
+		t.text(n.Data)
+		return
+	case html.ElementNode:
+		if t.opts.SkipHidden && !root && hiddenElements[n.Data] {
+			return
+		}
+	case html.DocumentNode:
+	default:
+		return
+	}
+
+	block, cell := false, false
+	if t.opts.Blocks && n.Type == html.ElementNode {
+		switch {
+		case n.Data == "br":
+			t.breaks++
+			return
+		case n.Data == "td" || n.Data == "th":
+			cell = true
+		case blockElements[n.Data]:
+			block = true
+		}
+	}
+	if block {
+		t.newline()
+	}
+	pre := n.Type == html.ElementNode && preElements[n.Data]
+	if pre {
+		t.pre++
+	}
+	for c := (*Node)(n.FirstChild); c != nil; c = (*Node)(c.NextSibling) {
+		t.node(c, false)
+	}
+	if pre {
+		t.pre--
+	}
+	if block {
+		t.newline()
+	} else if cell && t.wrote {
+		t.space = true
+	}
+}
+
+// newline asks for a line break before the next text, unless one is
+// already pending or nothing has been written yet.
+func (t *textWriter) newline() {
+	if t.wrote && t.breaks == 0 {
+		t.breaks = 1
+	}
+}
+
+func (t *textWriter) text(s string) {
+	if !t.opts.Collapse || t.pre > 0 {
+		if s != "" {
+			t.flush()
+			t.write(s)
+		}
+		return
+	}
+	for i := 0; i < len(s); {
+		j := i
+		for j < len(s) && isSpace(s[j]) {
+			j++
+		}
+		if j > i {
+			t.space = t.wrote
+			i = j
+			continue
+		}
+		for j < len(s) && !isSpace(s[j]) {
+			j++
+		}
+		t.flush()
+		t.write(s[i:j])
+		i = j
+	}
+}
+
+func (t *textWriter) flush() {
+	if t.breaks > 0 {
+		t.write(strings.Repeat("\n", t.breaks))
+	} else if t.space {
+		t.write(" ")
+	}
+	t.breaks, t.space = 0, false
+}
+
+func (t *textWriter) write(s string) {
+	if t.err == nil {
+		_, t.err = io.WriteString(t.w, s)
+	}
+	t.wrote = true
+}
@@ -0,0 +1,581 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Answer is the result of a static question about selectors.
+type Answer int
+
+const (
+	No Answer = iota
+	Yes
+	Unknown
+)
+
+func (a Answer) String() string {
+	switch a {
+	case No:
+		return "no"
+	case Yes:
+		return "yes"
+	}
+	return "unknown"
+}
+
+// Subset reports whether every element matched by a is also matched by b,
+// in any document. Yes is only returned when it holds for every document,
+// No only when a counterexample exists; everything else, including AST
+// nodes this package does not know, gives Unknown. Attribute operators
+// follow CSS semantics, see Impossible.
+func Subset(a, b AST) Answer {
+	as, ok1 := chains(a)
+	bs, ok2 := chains(b)
+	if !ok1 || !ok2 {
+		return Unknown
+	}
+	fresh := newFresh(a, b)
+	answer := Yes
+	for _, x := range as {
+		if ok, _ := Impossible(x.ast()); ok {
+			continue
+		}
+		if covered(x, bs) {
+			continue
+		}
+		if w, ok := x.realize(fresh); ok && !matchAny(bs, w) {
+			return No
+		}
+		answer = Unknown
+	}
+	return answer
+}
+
+// Equivalent reports whether a and b match the same elements in every
+// document.
+func Equivalent(a, b AST) Answer {
+	x, y := Subset(a, b), Subset(b, a)
+	switch {
+	case x == No || y == No:
+		return No
+	case x == Yes && y == Yes:
+		return Yes
+	}
+	return Unknown
+}
+
+// Overlap reports whether some element in some document is matched by
+// both a and b.
+func Overlap(a, b AST) Answer {
+	as, ok1 := chains(a)
+	bs, ok2 := chains(b)
+	if !ok1 || !ok2 {
+		return Unknown
+	}
+	fresh := newFresh(a, b)
+	answer := No
+	for _, x := range as {
+		for _, y := range bs {
+			switch overlap(x, y, fresh) {
+			case Yes:
+				return Yes
+			case Unknown:
+				answer = Unknown
+			}
+		}
+	}
+	return answer
+}
+
+func overlap(x, y chain, fresh *fresh) Answer {
+	if ok, _ := Impossible(x.ast()); ok {
+		return No
+	}
+	if ok, _ := Impossible(y.ast()); ok {
+		return No
+	}
+	subject := compound{}
+	if !subject.merge(x.subject()) || !subject.merge(y.subject()) {
+		return No
+	}
+	if ok, _ := Impossible(subject.element()); ok {
+		return No
+	}
+	for _, c := range []chain{x.join(y, subject, ""), x.join(y, subject, " "), y.join(x, subject, ""), y.join(x, subject, " ")} {
+		if w, ok := c.realize(fresh); ok && x.match(w) && y.match(w) {
+			return Yes
+		}
+	}
+	return Unknown
+}
+
+func covered(x chain, bs []chain) bool {
+	for _, y := range bs {
+		if x.embeds(y, len(x.compounds)-1, len(y.compounds)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(bs []chain, w *witness) bool {
+	for _, y := range bs {
+		if y.match(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// chain is a complex selector: compounds joined by ops, left to right.
+type chain struct {
+	compounds []*compound
+	ops       []string
+}
+
+func chains(ast AST) ([]chain, bool) {
+	if x, ok := ast.(Selector); ok {
+		cs := []chain{}
+		for _, exp := range x.Seq {
+			c, ok := toChain(exp)
+			if !ok {
+				return nil, false
+			}
+			cs = append(cs, c)
+		}
+		return cs, true
+	}
+	c, ok := toChain(ast)
+	return []chain{c}, ok
+}
+
+func toChain(ast AST) (chain, bool) {
+	switch x := ast.(type) {
+	case Element:
+		c, ok := newCompound(x)
+		return chain{compounds: []*compound{c}}, ok
+	case Exp:
+		left, ok := toChain(x.E)
+		if !ok {
+			return chain{}, false
+		}
+		el, ok := x.F.(Element)
+		if !ok {
+			return chain{}, false
+		}
+		c, ok := newCompound(el)
+		if !ok {
+			return chain{}, false
+		}
+		switch x.Op {
+		case " ", ">", "+", "~":
+		default:
+			return chain{}, false
+		}
+		return chain{
+			compounds: append(append([]*compound{}, left.compounds...), c),
+			ops:       append(append([]string{}, left.ops...), x.Op),
+		}, true
+	}
+	return chain{}, false
+}
+
+func (c chain) ast() AST {
+	var ast AST = c.compounds[0].element()
+	for i, op := range c.ops {
+		ast = Exp{E: ast, F: c.compounds[i+1].element(), Op: op}
+	}
+	return ast
+}
+
+func (c chain) subject() *compound {
+	return c.compounds[len(c.compounds)-1]
+}
+
+// join returns a chain whose subject is subject, placed after everything
+// that c and d require of their subjects' surroundings: c's prefix comes
+// first and is linked to d's prefix with link, or with c's own last
+// combinator if link is empty. It is only a candidate; callers must check
+// the realization against both selectors.
+func (c chain) join(d chain, subject compound, link string) chain {
+	n := len(c.compounds) - 1
+	out := chain{compounds: append([]*compound{}, c.compounds[:n]...), ops: append([]string{}, c.ops...)}
+	if n > 0 && len(d.compounds) > 1 && link != "" {
+		out.ops[n-1] = link
+	}
+	out.compounds = append(out.compounds, d.compounds[:len(d.compounds)-1]...)
+	out.ops = append(out.ops, d.ops...)
+	out.compounds = append(out.compounds, &subject)
+	return out
+}
+
+type relation int
+
+const (
+	relNone relation = iota
+	relParent
+	relAncestor
+	relPrev
+	relSibling
+)
+
+// relation returns what c guarantees about its k-th compound relative to
+// its i-th, k < i.
+func (c chain) relation(k, i int) relation {
+	const (
+		same = iota
+		ancestor
+		ancestorSibling
+	)
+	state, rel := same, relNone
+	for j := i - 1; j >= k; j-- {
+		up := c.ops[j] == " " || c.ops[j] == ">"
+		switch {
+		case state == same && !up:
+			rel = relSibling
+			if j == i-1 && c.ops[j] == "+" {
+				rel = relPrev
+			}
+		case state == same && c.ops[j] == ">":
+			state, rel = ancestor, relParent
+		case up:
+			state, rel = ancestor, relAncestor
+		default:
+			state, rel = ancestorSibling, relNone
+		}
+	}
+	return rel
+}
+
+// embeds reports whether d's compounds 0..j can be mapped onto c's
+// compounds 0..i, with d's j-th onto c's i-th, so that c guarantees every
+// combinator of d.
+func (c chain) embeds(d chain, i, j int) bool {
+	if !c.compounds[i].implies(d.compounds[j]) {
+		return false
+	}
+	if j == 0 {
+		return true
+	}
+	for k := i - 1; k >= 0; k-- {
+		rel := c.relation(k, i)
+		ok := false
+		switch d.ops[j-1] {
+		case " ":
+			ok = rel == relParent || rel == relAncestor
+		case ">":
+			ok = rel == relParent
+		case "~":
+			ok = rel == relPrev || rel == relSibling
+		case "+":
+			ok = rel == relPrev
+		}
+		if ok && c.embeds(d, k, j-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// witness is an element of a small document built to satisfy a chain.
+type witness struct {
+	tag    string
+	attrs  map[string]string
+	parent *witness
+	prev   *witness
+}
+
+// realize builds a document satisfying c and returns c's subject in it.
+// Descendant and general sibling combinators get an unrelated element in
+// between, so the document does not satisfy stricter combinators by
+// accident.
+func (c chain) realize(fresh *fresh) (*witness, bool) {
+	var w *witness
+	for i, comp := range c.compounds {
+		next := comp.realize(fresh)
+		if i > 0 {
+			filler := &witness{tag: fresh.tag, attrs: map[string]string{}}
+			switch c.ops[i-1] {
+			case " ":
+				filler.parent = w
+				next.parent = filler
+			case ">":
+				next.parent = w
+			case "~":
+				filler.parent, filler.prev = w.parent, w
+				next.parent, next.prev = w.parent, filler
+			case "+":
+				next.parent, next.prev = w.parent, w
+			}
+		}
+		w = next
+	}
+	return w, c.match(w)
+}
+
+func (c chain) match(w *witness) bool {
+	return c.matchAt(len(c.compounds)-1, w)
+}
+
+func (c chain) matchAt(i int, w *witness) bool {
+	if !c.compounds[i].match(w) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch c.ops[i-1] {
+	case " ":
+		for p := w.parent; p != nil; p = p.parent {
+			if c.matchAt(i-1, p) {
+				return true
+			}
+		}
+	case ">":
+		return w.parent != nil && c.matchAt(i-1, w.parent)
+	case "+":
+		return w.prev != nil && c.matchAt(i-1, w.prev)
+	case "~":
+		for s := w.prev; s != nil; s = s.prev {
+			if c.matchAt(i-1, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compound is the set of conditions of an Element. Ids are kept as
+// [id=...] conditions.
+type compound struct {
+	tag     string
+	classes []string
+	attrs   []Attr
+}
+
+func newCompound(el Element) (*compound, bool) {
+	c := &compound{}
+	if len(el.Seq) == 0 {
+		// An empty compound matches nothing, which no compound can express.
+		return c, false
+	}
+	for _, ast := range el.Seq {
+		switch x := ast.(type) {
+		case Tag:
+			if !c.merge(&compound{tag: strings.ToLower(x.Name)}) {
+				return c, false
+			}
+		case Id:
+			c.attrs = append(c.attrs, Attr{Name: "id", Type: "=", Value: x.Name})
+		case Class:
+			c.classes = append(c.classes, x.Name)
+		case Attr:
+			x.Name = strings.ToLower(x.Name)
+			c.attrs = append(c.attrs, x)
+		default:
+			return c, false
+		}
+	}
+	return c, true
+}
+
+// merge adds the conditions of d to c. It returns false if their type
+// selectors differ.
+func (c *compound) merge(d *compound) bool {
+	if d.tag != "" && d.tag != "*" {
+		if c.tag != "" && c.tag != d.tag {
+			return false
+		}
+		c.tag = d.tag
+	}
+	c.classes = append(c.classes, d.classes...)
+	c.attrs = append(c.attrs, d.attrs...)
+	return true
+}
+
+func (c *compound) element() Element {
+	el := Element{}
+	if c.tag != "" {
+		el.Seq = append(el.Seq, Tag{Name: c.tag})
+	}
+	for _, class := range c.classes {
+		el.Seq = append(el.Seq, Class{Name: class})
+	}
+	for _, a := range c.attrs {
+		el.Seq = append(el.Seq, a)
+	}
+	if len(el.Seq) == 0 {
+		el.Seq = append(el.Seq, Tag{Name: "*"})
+	}
+	return el
+}
+
+func (c *compound) exact(name string) (string, bool) {
+	for _, a := range c.attrs {
+		if a.Name == name && a.Type == "=" {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func (c *compound) hasClass(name string) bool {
+	for _, class := range c.classes {
+		if class == name {
+			return true
+		}
+	}
+	return false
+}
+
+// implies reports whether every element matching c also matches d.
+func (c *compound) implies(d *compound) bool {
+	if d.tag != "" && d.tag != c.tag {
+		return false
+	}
+	for _, class := range d.classes {
+		if !c.hasClass(class) {
+			return false
+		}
+	}
+	for _, b := range d.attrs {
+		if v, ok := c.exact(b.Name); ok {
+			if !attrMatch(b, v) {
+				return false
+			}
+			continue
+		}
+		ok := b.Name == "class" && b.Type == "" && len(c.classes) > 0
+		for _, a := range c.attrs {
+			ok = ok || a.Name == b.Name && attrImplies(a, b)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func attrImplies(a, b Attr) bool {
+	if b.Type == "" {
+		return true
+	}
+	if b.Value == "" && b.Type != "=" {
+		return false
+	}
+	switch b.Type {
+	case "=":
+		return a.Type == "=" && a.Value == b.Value
+	case "^=":
+		return (a.Type == "=" || a.Type == "^=") && strings.HasPrefix(a.Value, b.Value)
+	case "$=":
+		return (a.Type == "=" || a.Type == "$=") && strings.HasSuffix(a.Value, b.Value)
+	case "*=":
+		return a.Type != "" && strings.Contains(a.Value, b.Value)
+	}
+	return false
+}
+
+func (c *compound) match(w *witness) bool {
+	if c.tag != "" && c.tag != w.tag {
+		return false
+	}
+	if len(c.classes) > 0 {
+		val, ok := w.attrs["class"]
+		if !ok {
+			return false
+		}
+		tokens := strings.Fields(val)
+		for _, class := range c.classes {
+			found := false
+			for _, t := range tokens {
+				found = found || t == class
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		if val, ok := w.attrs[a.Name]; !ok || !attrMatch(a, val) {
+			return false
+		}
+	}
+	return true
+}
+
+// realize builds an element satisfying c that is as generic as possible:
+// values only contain what the conditions demand, separated by a rune that
+// no selector in the question uses.
+func (c *compound) realize(fresh *fresh) *witness {
+	w := &witness{tag: c.tag, attrs: map[string]string{}}
+	if w.tag == "" {
+		w.tag = fresh.tag
+	}
+	names := []string{}
+	for _, a := range c.attrs {
+		if _, ok := w.attrs[a.Name]; !ok {
+			names = append(names, a.Name)
+			w.attrs[a.Name] = ""
+		}
+	}
+	if len(c.classes) > 0 {
+		if _, ok := w.attrs["class"]; !ok {
+			names = append(names, "class")
+		}
+	}
+	for _, name := range names {
+		if v, ok := c.exact(name); ok {
+			w.attrs[name] = v
+			continue
+		}
+		sep := fresh.sep
+		prefix, suffix, parts := "", "", []string{}
+		if name == "class" {
+			sep = " "
+			parts = append(parts, c.classes...)
+		}
+		for _, a := range c.attrs {
+			if a.Name != name {
+				continue
+			}
+			switch a.Type {
+			case "^=":
+				if len(a.Value) > len(prefix) {
+					prefix = a.Value
+				}
+			case "$=":
+				if len(a.Value) > len(suffix) {
+					suffix = a.Value
+				}
+			case "*=":
+				parts = append(parts, a.Value)
+			}
+		}
+		w.attrs[name] = prefix + sep + strings.Join(parts, sep) + sep + suffix
+	}
+	return w
+}
+
+// fresh holds a tag name and a separator that do not occur in any of the
+// selectors being compared.
+type fresh struct {
+	tag string
+	sep string
+}
+
+func newFresh(asts ...AST) *fresh {
+	text := ""
+	for _, ast := range asts {
+		text += Format(ast)
+	}
+	f := &fresh{tag: "w", sep: "\x1f"}
+	for i := 0; strings.Contains(text, f.tag); i++ {
+		f.tag = "w" + strconv.Itoa(i)
+	}
+	for r := rune(0x1f); strings.ContainsRune(text, r); r++ {
+		f.sep = string(r + 1)
+	}
+	return f
+}
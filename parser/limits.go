@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ParserOptions bounds the work done for a selector. A zero field means no
+// limit.
+type ParserOptions struct {
+	MaxLength   int // runes in the input
+	MaxCompound int // simple selectors in a compound, e.g. 3 for a.b[c]
+	MaxDepth    int // compounds in a complex selector, e.g. 3 for a > b c
+	MaxList     int // branches in one selector list
+}
+
+// DefaultParserOptions are generous limits for selectors from untrusted
+// sources.
+var DefaultParserOptions = ParserOptions{
+	MaxLength:   4096,
+	MaxCompound: 32,
+	MaxDepth:    64,
+	MaxList:     256,
+}
+
+var ErrLimitExceeded = errors.New("selector limit exceeded")
+
+// LimitError reports which limit of ParserOptions a selector exceeded.
+// It matches ErrLimitExceeded with errors.Is.
+type LimitError struct {
+	Limit string
+	Max   int
+	Pos   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s exceeds %d at %d", ErrLimitExceeded, e.Limit, e.Max, e.Pos)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// limit fails the parse if n exceeds max.
+func (p *Parser) limit(name string, n, max int) bool {
+	if max > 0 && n > max && p.Builder.err == nil {
+		p.Builder.err = &LimitError{Limit: name, Max: max, Pos: p.pos}
+	}
+	return p.Builder.err == nil
+}
@@ -0,0 +1,251 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Normalize returns the canonical form of ast. Tag and attribute names are
+// lowercased, and inside every compound the type selector comes first,
+// followed by ids, classes and attributes in sorted order, with duplicates
+// and redundant universal selectors removed; an empty compound, which
+// matches nothing, stays empty. Branches of a selector list are
+// deduplicated and sorted, and branches that can never match, empty ones
+// included, are dropped unless nothing else is left.
+func Normalize(ast AST) AST {
+	switch x := ast.(type) {
+	case Selector:
+		seen := map[string]bool{}
+		seq, keys := []AST{}, []string{}
+		var impossible []AST
+		for _, exp := range x.Seq {
+			n := Normalize(exp)
+			if ok, _ := Impossible(n); ok {
+				impossible = append(impossible, n)
+				continue
+			}
+			if k := Format(n); !seen[k] {
+				seen[k] = true
+				seq = append(seq, n)
+				keys = append(keys, k)
+			}
+		}
+		if len(seq) == 0 && len(impossible) > 0 {
+			return Selector{Seq: impossible[:1]}
+		}
+		sort.Sort(branches{seq, keys})
+		return Selector{Seq: seq}
+	case Exp:
+		return Exp{E: Normalize(x.E), F: Normalize(x.F), Op: x.Op}
+	case Element:
+		return normalizeElement(x)
+	default:
+		return ast
+	}
+}
+
+// Key returns a string that is equal for two selectors whenever their
+// normalized forms are equal.
+func Key(ast AST) string {
+	return Format(Normalize(ast))
+}
+
+// Impossible reports whether no element can ever match ast, and why.
+// Attribute operators follow CSS semantics: they all require the attribute
+// to be present, and ^=, $= and *= never match an empty value.
+func Impossible(ast AST) (bool, string) {
+	switch x := ast.(type) {
+	case Selector:
+		reason := "empty selector list"
+		for _, exp := range x.Seq {
+			ok, why := Impossible(exp)
+			if !ok {
+				return false, ""
+			}
+			reason = why
+		}
+		return true, reason
+	case Exp:
+		if ok, why := Impossible(x.E); ok {
+			return true, why
+		}
+		return Impossible(x.F)
+	case Element:
+		return impossibleElement(x)
+	default:
+		return false, ""
+	}
+}
+
+type branches struct {
+	seq  []AST
+	keys []string
+}
+
+func (b branches) Len() int           { return len(b.seq) }
+func (b branches) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b branches) Swap(i, j int) {
+	b.seq[i], b.seq[j] = b.seq[j], b.seq[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+func normalizeElement(el Element) Element {
+	var tags, ids, classes []string
+	var attrs []Attr
+	for _, ast := range el.Seq {
+		switch x := ast.(type) {
+		case Tag:
+			if x.Name != "*" {
+				tags = append(tags, strings.ToLower(x.Name))
+			}
+		case Id:
+			ids = append(ids, x.Name)
+		case Class:
+			classes = append(classes, x.Name)
+		case Attr:
+			x.Name = strings.ToLower(x.Name)
+			if x.Name == "id" && x.Type == "=" && isIdent(x.Value) {
+				ids = append(ids, x.Value)
+			} else {
+				attrs = append(attrs, x)
+			}
+		}
+	}
+	tags, ids, classes = dedupe(tags), dedupe(ids), dedupe(classes)
+
+	valued := map[string]bool{}
+	for _, a := range attrs {
+		if a.Type != "" {
+			valued[a.Name] = true
+		}
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].Name != attrs[j].Name {
+			return attrs[i].Name < attrs[j].Name
+		}
+		if attrs[i].Type != attrs[j].Type {
+			return attrs[i].Type < attrs[j].Type
+		}
+		return attrs[i].Value < attrs[j].Value
+	})
+
+	seq := []AST{}
+	for _, t := range tags {
+		seq = append(seq, Tag{Name: t})
+	}
+	for _, id := range ids {
+		seq = append(seq, Id{Name: id})
+	}
+	for _, c := range classes {
+		seq = append(seq, Class{Name: c})
+	}
+	for i, a := range attrs {
+		if i > 0 && a == attrs[i-1] || a.Type == "" && valued[a.Name] {
+			continue
+		}
+		seq = append(seq, a)
+	}
+	if len(seq) == 0 && len(el.Seq) > 0 {
+		seq = append(seq, Tag{Name: "*"})
+	}
+	return Element{Seq: seq}
+}
+
+func impossibleElement(el Element) (bool, string) {
+	if len(el.Seq) == 0 {
+		return true, "empty compound selector"
+	}
+	attrs := map[string][]Attr{}
+	names := []string{}
+	for _, ast := range el.Seq {
+		var a Attr
+		switch x := ast.(type) {
+		case Id:
+			a = Attr{Name: "id", Type: "=", Value: x.Name}
+		case Attr:
+			a = x
+			a.Name = strings.ToLower(a.Name)
+		default:
+			continue
+		}
+		if _, ok := attrs[a.Name]; !ok {
+			names = append(names, a.Name)
+		}
+		attrs[a.Name] = append(attrs[a.Name], a)
+	}
+	for _, name := range names {
+		if ok, why := conflicting(attrs[name]); ok {
+			return true, why
+		}
+	}
+	return false, ""
+}
+
+func conflicting(attrs []Attr) (bool, string) {
+	exact, hasExact := "", false
+	for _, a := range attrs {
+		if a.Value == "" && (a.Type == "^=" || a.Type == "$=" || a.Type == "*=") {
+			return true, fmt.Sprintf("%s never matches", Format(a))
+		}
+		if a.Type == "=" {
+			if hasExact && exact != a.Value {
+				return true, fmt.Sprintf("%s conflicts with %s=%s", Format(a), a.Name, quote(exact))
+			}
+			exact, hasExact = a.Value, true
+		}
+	}
+	for i, a := range attrs {
+		if hasExact && !attrMatch(a, exact) {
+			return true, fmt.Sprintf("%s conflicts with %s=%s", Format(a), a.Name, quote(exact))
+		}
+		for _, b := range attrs[i+1:] {
+			if a.Type != b.Type {
+				continue
+			}
+			if a.Type == "^=" && !strings.HasPrefix(a.Value, b.Value) && !strings.HasPrefix(b.Value, a.Value) ||
+				a.Type == "$=" && !strings.HasSuffix(a.Value, b.Value) && !strings.HasSuffix(b.Value, a.Value) {
+				return true, fmt.Sprintf("%s conflicts with %s", Format(a), Format(b))
+			}
+		}
+	}
+	return false, ""
+}
+
+// attrMatch tests a single attribute condition against a present value.
+func attrMatch(a Attr, val string) bool {
+	switch a.Type {
+	case "":
+		return true
+	case "=":
+		return val == a.Value
+	case "^=":
+		return a.Value != "" && strings.HasPrefix(val, a.Value)
+	case "$=":
+		return a.Value != "" && strings.HasSuffix(val, a.Value)
+	case "*=":
+		return a.Value != "" && strings.Contains(val, a.Value)
+	}
+	return false
+}
+
+func dedupe(s []string) []string {
+	sort.Strings(s)
+	out := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func isIdent(s string) bool {
+	for i, c := range s {
+		if !(unicode.IsLetter(c) || c == '_' || i > 0 && (c == '-' || unicode.IsDigit(c))) {
+			return false
+		}
+	}
+	return s != ""
+}
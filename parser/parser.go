@@ -3,6 +3,7 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/SteveZhangBit/leiogo-css/lexer"
 )
@@ -10,27 +11,121 @@ import (
 type Parser struct {
 	lexer     *lexer.Lexer
 	lookahead lexer.Token
+	pos       int
+	src       []rune
+	opts      ParserOptions
+	depth     int
+	empty     bool // the last compound had no simple selectors
 	Builder   ASTBuilder
 }
 
+// Diagnostic describes a branch of a selector list that ParseForgiving
+// dropped. Pos is the rune offset of the offending token, Start and End
+// delimit the dropped branch.
+type Diagnostic struct {
+	Pos    int
+	Start  int
+	End    int
+	Branch string
+	Err    error
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%d: %s in %q", d.Pos, d.Err, d.Branch)
+}
+
 func NewParser(str string) *Parser {
-	p := Parser{lexer: lexer.NewLexer(str)}
-	p.match(lexer.Token{}.Type)
+	return NewParserWithOptions(str, ParserOptions{})
+}
+
+func NewParserWithOptions(str string, opts ParserOptions) *Parser {
+	p := Parser{lexer: lexer.NewLexer(str), src: []rune(str), opts: opts}
+	if p.limit("length", len(p.src), opts.MaxLength) {
+		p.match(lexer.Token{}.Type)
+	}
 	return &p
 }
 
+// Parse parses a selector list and fails on the first error. Unquoted
+// attribute values end at a comma, so that ParseForgiving can recover at
+// it: [x=1,2] is an error and must be written [x="1,2"].
 func (p *Parser) Parse() (AST, error) {
 	p.entry()
 	return p.Builder.build(), p.Builder.err
 }
 
+// ParseForgiving parses a selector list, recovering at commas. Invalid
+// branches, empty ones included, are left out of the result and reported
+// as diagnostics; the AST is nil if no branch is valid. A limit ends the
+// parse, but the branches before it are still returned.
+func (p *Parser) ParseForgiving() (AST, []Diagnostic) {
+	var diags []Diagnostic
+	p.space()
+	for branches := 1; ; branches++ {
+		start, size := p.pos, len(p.Builder.stack)
+		p.limit("list", branches, p.opts.MaxList)
+		p.exp()
+		if p.Builder.err == nil && p.lookahead.Type != lexer.Comma && p.lookahead.Type != lexer.EOF {
+			p.err(lexer.Comma, lexer.EOF)
+		}
+		if err := p.Builder.err; errors.Is(err, ErrLimitExceeded) {
+			p.Builder.err = nil
+			p.Builder.stack = p.Builder.stack[:size]
+			p.Builder.count = 0
+			diags = append(diags, Diagnostic{
+				Pos:    p.pos,
+				Start:  start,
+				End:    len(p.src),
+				Branch: strings.TrimSpace(string(p.src[start:])),
+				Err:    err,
+			})
+			break
+		} else if err != nil {
+			pos := p.pos
+			p.Builder.err = nil
+			p.Builder.stack = p.Builder.stack[:size]
+			p.Builder.count = 0
+			// The error may have left the lexer inside an attribute
+			// bracket, where it would not see the next comma.
+			p.lexer.Reset()
+			for p.lookahead.Type != lexer.Comma && p.lookahead.Type != lexer.EOF {
+				p.next()
+				p.lexer.Reset()
+			}
+			diags = append(diags, Diagnostic{
+				Pos:    pos,
+				Start:  start,
+				End:    p.pos,
+				Branch: strings.TrimSpace(string(p.src[start:p.pos])),
+				Err:    err,
+			})
+		}
+		if p.lookahead.Type != lexer.Comma {
+			break
+		}
+		p.match(lexer.Comma)
+		p.space()
+	}
+	if len(p.Builder.stack) == 0 {
+		return nil, diags
+	}
+	p.Builder.selector()
+	return p.Builder.build(), diags
+}
+
+func (p *Parser) next() (err error) {
+	p.pos = p.lexer.Pos()
+	p.lookahead, err = p.lexer.NextToken()
+	return
+}
+
 func (p *Parser) match(t lexer.TokenType) {
 	if p.Builder.err != nil {
 		return
 	}
 
 	if p.lookahead.Type == t {
-		p.lookahead, p.Builder.err = p.lexer.NextToken()
+		p.Builder.err = p.next()
 	} else {
 		p.Builder.err = errors.New(fmt.Sprintf("Need %s, Get %s", t, p.lookahead))
 	}
@@ -42,20 +137,25 @@ func (p *Parser) entry() {
 }
 
 func (p *Parser) selector() {
+	p.space()
 	p.exp()
 	p.selector_()
 }
 
 func (p *Parser) selector_() {
-	switch p.lookahead.Type {
-	case lexer.Comma:
-		p.match(lexer.Comma)
-		p.space()
-		p.selector()
-	case lexer.EOF:
-		return
-	default:
-		p.err(lexer.Comma, lexer.EOF)
+	for branches := 2; p.Builder.err == nil; branches++ {
+		switch p.lookahead.Type {
+		case lexer.Comma:
+			p.match(lexer.Comma)
+			p.space()
+			if p.limit("list", branches, p.opts.MaxList) {
+				p.exp()
+			}
+		case lexer.EOF:
+			return
+		default:
+			p.err(lexer.Comma, lexer.EOF)
+		}
 	}
 }
 
@@ -65,16 +165,35 @@ func (p *Parser) space() {
 	}
 }
 
+// exp parses a branch of a selector list. A branch must start with a
+// compound, so empty branches as in ",a", "a,,b" or "" are errors.
 func (p *Parser) exp() {
 	p.element()
+	if p.Builder.err == nil && p.empty {
+		p.err(lexer.Identifier, lexer.Star, lexer.Sharp, lexer.Dot, lexer.LeftBracket)
+		return
+	}
 	p.exp_()
 }
 
+// exp_ recurses once for every compound of a complex selector, which is
+// what MaxDepth bounds. Like element and adjunct it returns as soon as the
+// parse has failed, since match no longer consumes tokens then.
 func (p *Parser) exp_() {
+	if p.Builder.err != nil {
+		return
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	if !p.limit("depth", p.depth, p.opts.MaxDepth) {
+		return
+	}
 	switch p.lookahead.Type {
 	case lexer.Blank:
 		p.match(lexer.Blank)
-		p.expCombine()
+		if p.lookahead.Type != lexer.Comma && p.lookahead.Type != lexer.EOF {
+			p.expCombine()
+		}
 	case lexer.Greater:
 		p.child()
 	case lexer.Plus:
@@ -89,6 +208,9 @@ func (p *Parser) exp_() {
 }
 
 func (p *Parser) expCombine() {
+	if p.Builder.err != nil {
+		return
+	}
 	switch p.lookahead.Type {
 	case lexer.Greater:
 		p.child()
@@ -102,7 +224,7 @@ func (p *Parser) expCombine() {
 }
 
 func (p *Parser) descendant() {
-	p.element()
+	p.compound()
 	p.Builder.exp(" ")
 	p.exp_()
 }
@@ -110,7 +232,7 @@ func (p *Parser) descendant() {
 func (p *Parser) child() {
 	p.match(lexer.Greater)
 	p.space()
-	p.element()
+	p.compound()
 	p.Builder.exp(">")
 	p.exp_()
 }
@@ -118,7 +240,7 @@ func (p *Parser) child() {
 func (p *Parser) imPrecedent() {
 	p.match(lexer.Plus)
 	p.space()
-	p.element()
+	p.compound()
 	p.Builder.exp("+")
 	p.exp_()
 }
@@ -126,20 +248,43 @@ func (p *Parser) imPrecedent() {
 func (p *Parser) precedent() {
 	p.match(lexer.Wave)
 	p.space()
-	p.element()
+	p.compound()
 	p.Builder.exp("~")
 	p.exp_()
 }
 
 func (p *Parser) element() {
+	if p.Builder.err != nil {
+		return
+	}
+	p.empty = true
 	if p.lookahead.Type == lexer.Identifier || p.lookahead.Type == lexer.Star {
 		p.tag()
+		p.empty = false
 	}
 	p.adjunct()
 	p.Builder.element()
 }
 
+// compound is an element that cannot be empty, as after a combinator.
+func (p *Parser) compound() {
+	p.element()
+	if p.empty {
+		p.err(lexer.Identifier, lexer.Star, lexer.Sharp, lexer.Dot, lexer.LeftBracket)
+	}
+}
+
 func (p *Parser) adjunct() {
+	if p.Builder.err != nil {
+		return
+	}
+	switch p.lookahead.Type {
+	case lexer.Sharp, lexer.Dot, lexer.LeftBracket:
+		if !p.limit("compound", p.Builder.count+1, p.opts.MaxCompound) {
+			return
+		}
+		p.empty = false
+	}
 	switch p.lookahead.Type {
 	case lexer.Sharp:
 		p.id()
@@ -226,7 +371,7 @@ func (p *Parser) literal() {
 	switch t := p.lookahead; t.Type {
 	case lexer.String:
 		p.match(lexer.String)
-		p.Builder.push(t.Value[1 : len(t.Value)-1])
+		p.Builder.push(unescape.Replace(t.Value[1 : len(t.Value)-1]))
 	case lexer.Literal:
 		p.match(lexer.Literal)
 		p.Builder.push(t.Value)
@@ -235,6 +380,12 @@ func (p *Parser) literal() {
 	}
 }
 
+// unescape undoes the escapes the lexer allows in strings.
+var unescape = strings.NewReplacer(`\"`, `"`, `\'`, `'`, `\\`, `\`)
+
 func (p *Parser) err(need ...lexer.TokenType) {
+	if p.Builder.err != nil {
+		return
+	}
 	p.Builder.err = errors.New(fmt.Sprintf("Need %s, get %s", need, p.lookahead))
 }
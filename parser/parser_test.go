@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -53,3 +55,264 @@ func Test9(t *testing.T) {
 func Test10(t *testing.T) {
 	test(t, "a, img[src=\"abc\"], div h3.cls[attr='abc.123']")
 }
+
+func parse(t *testing.T, str string) AST {
+	ast, err := NewParser(str).Parse()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return ast
+}
+
+func TestNormalize(t *testing.T) {
+	for _, c := range [][2]string{
+		{"a.b.a#x", "a#x.a.b"},
+		{"*.cls", ".cls"},
+		{"DIV[HREF]", "div[href]"},
+		{"*", "*"},
+		{"[href][href^=http]", `[href^="http"]`},
+		{"[id=main].x", "#main.x"},
+		{"div > p.b.a, p, div>p.a.b", "div > p.a.b, p"},
+		{"div .a[x=1], #a#b, p", `div .a[x="1"], p`},
+	} {
+		if key := Key(parse(t, c[0])); key != c[1] {
+			t.Errorf("Key(%q) = %q, need %q", c[0], key, c[1])
+		}
+	}
+
+	empty := Selector{Seq: []AST{Element{Seq: []AST{Tag{Name: "a"}}}, Element{}}}
+	if ok, _ := Impossible(Element{}); !ok || Key(empty) != "a" || Key(empty) == Key(parse(t, "*, a")) || Key(Element{}) != "" {
+		t.Errorf("Get %q, %q", Key(empty), Key(Element{}))
+	}
+
+	for _, v := range []string{`it's`, `say "hi"`, `"it's"`, `a\b`, `a\`, `\"'\'`} {
+		el := Element{Seq: []AST{Attr{Name: "x", Type: "=", Value: v}}}
+		str := Format(el)
+		if ast, err := NewParser(str).Parse(); err != nil || Format(ast) != str {
+			t.Errorf("Format(%q) = %s does not parse back: %v, %v", v, str, ast, err)
+		}
+		if ok, _ := Impossible(el); ok || Key(el) != str {
+			t.Errorf("Key(%q) = %s", v, Key(el))
+		}
+	}
+}
+
+func TestBlanks(t *testing.T) {
+	for str, need := range map[string]string{
+		" a":          "a",
+		"a ":          "a",
+		"a , b":       "a, b",
+		" div  >  p ": "div > p",
+	} {
+		if got := Key(parse(t, str)); got != need {
+			t.Errorf("%q: get %q, need %q", str, got, need)
+		}
+	}
+}
+
+func TestImpossible(t *testing.T) {
+	for str, need := range map[string]bool{
+		"#a#b":                  true,
+		"#a[id=b]":              true,
+		"[x^=ab][x^=ac]":        true,
+		"[x=abc][x$=b]":         true,
+		"[x*='']":               true,
+		"div #a#a > p":          false,
+		"[x^=ab][x^=a][x$=c]":   false,
+		"#a#b, p":               false,
+		"div span + #a.b[id=a]": false,
+	} {
+		if ok, why := Impossible(parse(t, str)); ok != need {
+			t.Errorf("Impossible(%q) = %v (%s), need %v", str, ok, why, need)
+		}
+	}
+}
+
+func TestParseForgiving(t *testing.T) {
+	ast, diags := NewParser("a.title, h1:unknown, .x, [href=").ParseForgiving()
+	if key := Format(ast); key != "a.title, .x" {
+		t.Errorf("Get %q, need %q", key, "a.title, .x")
+	}
+	if len(diags) != 2 {
+		t.Fatalf("Get %d diagnostics, need 2", len(diags))
+	}
+	if d := diags[0]; d.Pos != 11 || d.Branch != "h1:unknown" {
+		t.Errorf("Get %v", d)
+	}
+	if d := diags[1]; d.Start != 25 || d.Branch != "[href=" {
+		t.Errorf("Get %v", d)
+	}
+
+	if ast, diags := NewParser("p:x, :y").ParseForgiving(); ast != nil || len(diags) != 2 {
+		t.Errorf("Get %v, %v", ast, diags)
+	}
+
+	for _, c := range []struct {
+		str, need string
+		diags     int
+	}{
+		{",a", "a", 1},
+		{"a,,b", "a, b", 1},
+		{"a, ", "a", 1},
+		{"p:hover, .x, , y", ".x, y", 2},
+		{"", "", 1},
+		{" ", "", 1},
+		{",", "", 2},
+	} {
+		ast, diags := NewParser(c.str).ParseForgiving()
+		if c.need == "" && ast != nil || c.need != "" && Format(ast) != c.need || len(diags) != c.diags {
+			t.Errorf("%q: get %v, %v", c.str, ast, diags)
+		}
+		if _, err := NewParser(c.str).Parse(); err == nil {
+			t.Errorf("%q: need an error", c.str)
+		}
+	}
+
+	for _, bad := range []string{
+		"h1:unknown", "[href=", "[href=a b", `[href="x"`, "[href=x y z", "a[x y]",
+		"a[x ]", "[=x]", "a!", "div >", "div > > p", "#", "a[href^x]",
+	} {
+		ast, diags := NewParser(bad + ", .x").ParseForgiving()
+		if Format(ast) != ".x" || len(diags) != 1 || diags[0].Branch != bad {
+			t.Errorf("%q: get %v, %v", bad, ast, diags)
+		}
+		ast, diags = NewParser("p, " + bad + ", .x").ParseForgiving()
+		if Format(ast) != "p, .x" || len(diags) != 1 {
+			t.Errorf("%q: get %v, %v", bad, ast, diags)
+		}
+	}
+}
+
+func TestToXPath(t *testing.T) {
+	for css, need := range map[string]string{
+		"div > a":          "descendant-or-self::div/a",
+		"div a, #x":        "descendant-or-self::div/descendant-or-self::*/a | descendant-or-self::*[@id = 'x']",
+		"h1 + p.lead":      "descendant-or-self::h1/following-sibling::*[1]/self::p[@class and contains(concat(' ', normalize-space(@class), ' '), ' lead ')]",
+		"h1 ~ [title]":     "descendant-or-self::h1/following-sibling::*[@title]",
+		"a[href^=http]":    "descendant-or-self::a[@href and starts-with(@href, 'http')]",
+		"a[href$='.pdf']":  "descendant-or-self::a[@href and substring(@href, string-length(@href)-3) = '.pdf']",
+		`a[title*="it's"]`: `descendant-or-self::a[@title and contains(@title, "it's")]`,
+		"a[rel=nofollow]":  "descendant-or-self::a[@rel = 'nofollow']",
+		"DIV[HREF]":        "descendant-or-self::div[@href]",
+	} {
+		if xpath, err := ToXPath(parse(t, css)); err != nil || xpath != need {
+			t.Errorf("ToXPath(%q) = %q, %v, need %q", css, xpath, err, need)
+		}
+	}
+}
+
+func TestSubset(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		need Answer
+	}{
+		{"div.a > p.b", "p", Yes},
+		{"div.a > p.b", "div p", Yes},
+		{"DIV > P[HREF]", "div p[href]", Yes},
+		{"div > section + p", "div p", Yes},
+		{"ul > li + li ~ li", "li ~ li", Yes},
+		{"a[href^=https]", "a[href*=http]", Yes},
+		{"a[href='/x']", "[href$=x]", Yes},
+		{"#a#b", "span", Yes},
+		{"p, div.x", "p, div", Yes},
+		{"p", "div.a > p.b", No},
+		{"div p", "div > p", No},
+		{"a[href^=http]", "a[href^=https]", No},
+		{"p ~ a", "p + a", No},
+		{"p, span", "p", No},
+		{"[class^=x]", ".x", Unknown},
+	} {
+		if got := Subset(parse(t, c.a), parse(t, c.b)); got != c.need {
+			t.Errorf("Subset(%q, %q) = %v, need %v", c.a, c.b, got, c.need)
+		}
+	}
+}
+
+func TestEquivalentAndOverlap(t *testing.T) {
+	if got := Equivalent(parse(t, "a.x[id=b], p"), parse(t, "p, a#b.x.x, a.x#b")); got != Yes {
+		t.Errorf("Get %v", got)
+	}
+	if got := Equivalent(parse(t, "a.x"), parse(t, "a")); got != No {
+		t.Errorf("Get %v", got)
+	}
+	empty := Selector{Seq: []AST{Element{}}}
+	if got := Equivalent(empty, parse(t, "*, a")); got != Unknown {
+		t.Errorf("Get %v", got)
+	}
+	if got := Subset(parse(t, "a"), Selector{Seq: []AST{Element{Seq: []AST{Tag{Name: "a"}}}, Element{}}}); got != Unknown {
+		t.Errorf("Get %v", got)
+	}
+	for _, c := range []struct {
+		a, b string
+		need Answer
+	}{
+		{"div p", "section p", Yes},
+		{"p.a", "[title].b", Yes},
+		{"p", "span", No},
+		{"#a", "#b", No},
+		{"a > p", "[x^=y] + p", Yes},
+		{"div > p", "section > p", Unknown},
+	} {
+		if got := Overlap(parse(t, c.a), parse(t, c.b)); got != c.need {
+			t.Errorf("Overlap(%q, %q) = %v, need %v", c.a, c.b, got, c.need)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	opts := ParserOptions{MaxLength: 40, MaxCompound: 3, MaxList: 3, MaxDepth: 4}
+	for str, limit := range map[string]string{
+		"a.b.c":                          "",
+		"a.b.c.d":                        "compound",
+		"a, b, c":                        "",
+		"a, b, c, d":                     "list",
+		"div > p.a[href] span.x ~ a#b.c": "",
+		"a b c d e":                      "depth",
+		strings.Repeat("div ", 11):       "length",
+	} {
+		_, err := NewParserWithOptions(str, opts).Parse()
+		if limit == "" && err != nil {
+			t.Errorf("%q: %v", str, err)
+		} else if limit != "" {
+			var le *LimitError
+			if !errors.Is(err, ErrLimitExceeded) || !errors.As(err, &le) || le.Limit != limit {
+				t.Errorf("%q: get %v, need %s limit", str, err, limit)
+			}
+		}
+	}
+
+	ast, diags := NewParserWithOptions("a, b:x, c, d, e", opts).ParseForgiving()
+	if Format(ast) != "a, c" || len(diags) != 2 || !errors.Is(diags[1].Err, ErrLimitExceeded) {
+		t.Errorf("Get %v, %v", ast, diags)
+	}
+	ast, diags = NewParserWithOptions("a, b.c, d.e.f.g", opts).ParseForgiving()
+	if Format(ast) != "a, b.c" || len(diags) != 1 || !errors.Is(diags[0].Err, ErrLimitExceeded) {
+		t.Errorf("Get %v, %v", ast, diags)
+	}
+	if _, err := NewParserWithOptions("a", ParserOptions{MaxDepth: -1}).Parse(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBlankInBrackets(t *testing.T) {
+	for _, str := range []string{"a[x ]", "a[x y]", "p, a[x y]", "a[x y] > b", "a[x y], p"} {
+		if _, err := NewParser(str).Parse(); err == nil {
+			t.Errorf("%q: need an error", str)
+		}
+		if _, err := NewParserWithOptions(str, DefaultParserOptions).Parse(); err == nil {
+			t.Errorf("%q: need an error", str)
+		}
+		if _, diags := NewParser(str).ParseForgiving(); len(diags) != 1 {
+			t.Errorf("%q: get %v", str, diags)
+		}
+	}
+}
+
+func TestCommaInValue(t *testing.T) {
+	if _, err := NewParser("[x=1,2]").Parse(); err == nil {
+		t.Error("[x=1,2]: need an error")
+	}
+	if ast, err := NewParser(`[x="1,2"], [y='a, b']`).Parse(); err != nil || Format(ast) != `[x="1,2"], [y="a, b"]` {
+		t.Errorf("Get %v, %v", ast, err)
+	}
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 )
 
 func PrintVisitor(ast AST) (str string) {
@@ -9,7 +10,6 @@ func PrintVisitor(ast AST) (str string) {
 	case Selector:
 		str = ""
 		for _, exp := range x.Seq {
-			fmt.Sprintf("%T\n", exp)
 			str += PrintVisitor(exp) + ", "
 		}
 		str = str[:len(str)-2]
@@ -36,3 +36,55 @@ func PrintVisitor(ast AST) (str string) {
 		panic(fmt.Sprintf("Error type: %T", x))
 	}
 }
+
+// Format prints ast back as selector text that NewParser accepts and
+// parses to ast again. Attribute values are quoted, with quotes and
+// backslashes escaped when needed.
+func Format(ast AST) string {
+	switch x := ast.(type) {
+	case Selector:
+		seq := make([]string, len(x.Seq))
+		for i, exp := range x.Seq {
+			seq[i] = Format(exp)
+		}
+		return strings.Join(seq, ", ")
+	case Exp:
+		if x.Op == " " {
+			return Format(x.E) + " " + Format(x.F)
+		}
+		return Format(x.E) + " " + x.Op + " " + Format(x.F)
+	case Element:
+		str := ""
+		for _, el := range x.Seq {
+			str += Format(el)
+		}
+		return str
+	case Tag:
+		return x.Name
+	case Id:
+		return "#" + x.Name
+	case Class:
+		return "." + x.Name
+	case Attr:
+		if x.Type == "" {
+			return "[" + x.Name + "]"
+		}
+		return "[" + x.Name + x.Type + quote(x.Value) + "]"
+	default:
+		panic(fmt.Sprintf("Error type: %T", x))
+	}
+}
+
+// quote quotes s as a string the lexer reads back as s, escaping quotes
+// and backslashes when s holds both kinds of quotes or a backslash.
+func quote(s string) string {
+	switch {
+	case !strings.ContainsAny(s, `"\`):
+		return `"` + s + `"`
+	case !strings.ContainsAny(s, `'\`):
+		return "'" + s + "'"
+	}
+	return `"` + escape.Replace(s) + `"`
+}
+
+var escape = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ToXPath translates ast into an equivalent XPath 1.0 expression, following
+// the translation rules of Python's cssselect. The result selects from the
+// context node downwards, so "div > a" becomes
+// "descendant-or-self::div/a".
+//
+// Limitations: the grammar has no pseudo-classes or pseudo-elements, so
+// there is nothing to translate for them; ToXPath returns an error for any
+// AST node it does not know. Class selectors are translated with
+// normalize-space, which treats space, tab, CR and LF as separators but
+// not form feed. Tag and attribute names are lowercased, as the HTML
+// parser stores them that way, but foreign elements such as SVG's
+// clipPath keep their mixed case in the tree and are not found.
+func ToXPath(ast AST) (string, error) {
+	if x, ok := ast.(Selector); ok {
+		paths := make([]string, len(x.Seq))
+		for i, exp := range x.Seq {
+			path, err := ToXPath(exp)
+			if err != nil {
+				return "", err
+			}
+			paths[i] = path
+		}
+		return strings.Join(paths, " | "), nil
+	}
+	path, err := xpathPath(ast)
+	if err != nil {
+		return "", err
+	}
+	return "descendant-or-self::" + path, nil
+}
+
+func xpathPath(ast AST) (string, error) {
+	switch x := ast.(type) {
+	case Exp:
+		left, err := xpathPath(x.E)
+		if err != nil {
+			return "", err
+		}
+		right, err := xpathPath(x.F)
+		if err != nil {
+			return "", err
+		}
+		switch x.Op {
+		case " ":
+			return left + "/descendant-or-self::*/" + right, nil
+		case ">":
+			return left + "/" + right, nil
+		case "+":
+			return left + "/following-sibling::*[1]/self::" + right, nil
+		case "~":
+			return left + "/following-sibling::" + right, nil
+		}
+		return "", errors.New("Unsupported combinator: " + x.Op)
+	case Element:
+		name := "*"
+		conds := []string{}
+		for _, el := range x.Seq {
+			switch y := el.(type) {
+			case Tag:
+				name = strings.ToLower(y.Name)
+			case Id:
+				conds = append(conds, "@id = "+xpathLiteral(y.Name))
+			case Class:
+				conds = append(conds, fmt.Sprintf(
+					"@class and contains(concat(' ', normalize-space(@class), ' '), %s)",
+					xpathLiteral(" "+y.Name+" ")))
+			case Attr:
+				cond, err := xpathAttr(y)
+				if err != nil {
+					return "", err
+				}
+				conds = append(conds, cond)
+			default:
+				return "", errors.New(fmt.Sprintf("Unsupported selector: %T", y))
+			}
+		}
+		if len(conds) == 0 {
+			return name, nil
+		}
+		return name + "[" + strings.Join(conds, " and ") + "]", nil
+	default:
+		return "", errors.New(fmt.Sprintf("Unsupported selector: %T", x))
+	}
+}
+
+func xpathAttr(a Attr) (string, error) {
+	attr, val := "@"+strings.ToLower(a.Name), xpathLiteral(a.Value)
+	switch a.Type {
+	case "":
+		return attr, nil
+	case "=":
+		return attr + " = " + val, nil
+	}
+	if a.Value == "" {
+		return "0", nil
+	}
+	switch a.Type {
+	case "^=":
+		return fmt.Sprintf("%s and starts-with(%s, %s)", attr, attr, val), nil
+	case "$=":
+		return fmt.Sprintf("%s and substring(%s, string-length(%s)-%d) = %s",
+			attr, attr, attr, utf8.RuneCountInString(a.Value)-1, val), nil
+	case "*=":
+		return fmt.Sprintf("%s and contains(%s, %s)", attr, attr, val), nil
+	}
+	return "", errors.New("Unsupported attribute operator: " + a.Type)
+}
+
+func xpathLiteral(s string) string {
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	if !strings.Contains(s, `"`) {
+		return `"` + s + `"`
+	}
+	parts := []string{}
+	for i, part := range strings.Split(s, "'") {
+		if i > 0 {
+			parts = append(parts, `"'"`)
+		}
+		if part != "" {
+			parts = append(parts, "'"+part+"'")
+		}
+	}
+	return "concat(" + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,157 @@
+package selector
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/SteveZhangBit/leiogo-css/node"
+	"golang.org/x/net/html"
+)
+
+// AttrOk returns the attribute name of the first node, and whether it is
+// present. It is false if e is empty or holds an error.
+func (e *Elements) AttrOk(name string) (string, bool) {
+	if len(e.Nodes) == 0 || !e.Nodes[0].HasAttr(name) {
+		return "", false
+	}
+	return e.Nodes[0].GetAttr(name), true
+}
+
+// AttrOr returns the attribute name of the first node, or def if it is
+// missing.
+func (e *Elements) AttrOr(name, def string) string {
+	if val, ok := e.AttrOk(name); ok {
+		return val
+	}
+	return def
+}
+
+// BoolAttr reports whether the first node has the boolean attribute name,
+// such as disabled or checked. As in HTML, only presence counts, so
+// disabled="false" is true.
+func (e *Elements) BoolAttr(name string) bool {
+	_, ok := e.AttrOk(name)
+	return ok
+}
+
+// SetBoolAttr adds the boolean attribute name to every element, with an
+// empty value, or removes it.
+func (e *Elements) SetBoolAttr(name string, on bool) *Elements {
+	return e.mutate(func(n *node.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		if !on {
+			n.RemoveAttr(name)
+		} else if !n.HasAttr(name) {
+			n.SetAttr(name, "")
+		}
+	})
+}
+
+// Data returns the data-* attribute of the first node for a dataset key,
+// so Data("productId") reads data-product-id, and whether it is present.
+func (e *Elements) Data(key string) (string, bool) {
+	if len(e.Nodes) == 0 {
+		return "", false
+	}
+	return e.Nodes[0].GetData(key)
+}
+
+// Dataset returns the data-* attributes of the first node keyed as in the
+// DOM's dataset, or nil if e is empty or holds an error.
+func (e *Elements) Dataset() map[string]string {
+	if len(e.Nodes) == 0 {
+		return nil
+	}
+	return e.Nodes[0].Dataset()
+}
+
+// DataJSON decodes the data-* attribute of the first node for key as JSON
+// into v.
+func (e *Elements) DataJSON(key string, v interface{}) error {
+	if e.Err != nil {
+		return e.Err
+	}
+	op := call("DataJSON", key)
+	if len(e.Nodes) == 0 {
+		return e.wrap(op, ErrEmpty)
+	}
+	val, ok := e.Nodes[0].GetData(key)
+	if !ok {
+		return e.wrap(op, ErrNoAttr)
+	}
+	if err := json.Unmarshal([]byte(val), v); err != nil {
+		return e.wrap(op, err)
+	}
+	return nil
+}
+
+// DecodeData decodes the dataset of the first node into v, usually a
+// struct whose json tags name dataset keys. Each value is decoded for the
+// field it fills: string fields take it as it is, so data-name="123" stays
+// "123", and other fields decode it as JSON, so data-id="42" fills an int.
+func (e *Elements) DecodeData(v interface{}) error {
+	if e.Err != nil {
+		return e.Err
+	}
+	if len(e.Nodes) == 0 {
+		return e.wrap(call("DecodeData"), ErrEmpty)
+	}
+	t := reflect.TypeOf(v)
+	raw := map[string]json.RawMessage{}
+	for key, val := range e.Nodes[0].Dataset() {
+		if !stringData(t, key) && json.Valid([]byte(val)) {
+			raw[key] = json.RawMessage(val)
+		} else {
+			b, _ := json.Marshal(val)
+			raw[key] = b
+		}
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return e.wrap(call("DecodeData"), err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return e.wrap(call("DecodeData"), fmt.Errorf("decoding dataset: %w", err))
+	}
+	return nil
+}
+
+// stringData reports whether the dataset key decodes into a string in t,
+// matching struct fields by json name as encoding/json does.
+func stringData(t reflect.Type, key string) bool {
+	t = deref(t)
+	if t == nil {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return deref(t.Elem()).Kind() == reflect.String
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if !f.IsExported() || tag == "-" {
+				continue
+			}
+			name, _, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = f.Name
+			}
+			if strings.EqualFold(name, key) {
+				return deref(f.Type).Kind() == reflect.String
+			}
+		}
+	}
+	return false
+}
+
+func deref(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
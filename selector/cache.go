@@ -0,0 +1,60 @@
+package selector
+
+import (
+	"container/list"
+	"sync"
+)
+
+const cacheSize = 256
+
+// cache keeps the most recently used selectors compiled from strings
+// passed to Find, Child, Next and the other string based methods.
+var cache = newLRU(cacheSize)
+
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *lru) get(str string) (*Selector, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[str]; ok {
+		c.ll.MoveToFront(el)
+		return el.Value.(*Selector), true
+	}
+	return nil, false
+}
+
+func (c *lru) add(s *Selector) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[s.str]; ok {
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[s.str] = c.ll.PushFront(s)
+	if c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*Selector).str)
+	}
+}
+
+func compile(str string) (*Selector, error) {
+	if s, ok := cache.get(str); ok {
+		return s, nil
+	}
+	s, err := Compile(str)
+	if err != nil {
+		return nil, err
+	}
+	cache.add(s)
+	return s, nil
+}
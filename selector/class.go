@@ -0,0 +1,58 @@
+package selector
+
+import (
+	"strings"
+
+	"github.com/SteveZhangBit/leiogo-css/node"
+	"golang.org/x/net/html"
+)
+
+// HasClass reports whether any node of e has the class.
+func (e *Elements) HasClass(class string) bool {
+	if e.Err != nil {
+		return false
+	}
+	for _, n := range e.Nodes {
+		if n.ClassList().Has(class) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddClass adds the whitespace separated classes to every element of e.
+func (e *Elements) AddClass(classes string) *Elements {
+	return e.classHelper(classes, func(l node.ClassList, cs []string) { l.Add(cs...) })
+}
+
+// RemoveClass removes the whitespace separated classes from every element
+// of e.
+func (e *Elements) RemoveClass(classes string) *Elements {
+	return e.classHelper(classes, func(l node.ClassList, cs []string) { l.Remove(cs...) })
+}
+
+// ToggleClass toggles each of the whitespace separated classes on every
+// element of e.
+func (e *Elements) ToggleClass(classes string) *Elements {
+	return e.classHelper(classes, func(l node.ClassList, cs []string) {
+		for _, c := range cs {
+			l.Toggle(c)
+		}
+	})
+}
+
+func (e *Elements) classHelper(classes string, f func(l node.ClassList, cs []string)) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	cs := strings.FieldsFunc(classes, func(r rune) bool {
+		return strings.ContainsRune(" \t\n\f\r", r)
+	})
+	for _, n := range e.Nodes {
+		if n.Type == html.ElementNode {
+			f(n.ClassList(), cs)
+		}
+	}
+	e.Invalidate()
+	return e
+}
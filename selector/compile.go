@@ -0,0 +1,65 @@
+package selector
+
+import (
+	"github.com/SteveZhangBit/leiogo-css/node"
+	"github.com/SteveZhangBit/leiogo-css/parser"
+)
+
+// Selector is a parsed selector. It is immutable and can be shared by
+// several goroutines and applied to any number of documents.
+type Selector struct {
+	str   string
+	ast   parser.AST
+	query *node.Query
+}
+
+// Compile parses str without limits. Selectors from untrusted sources
+// should go through CompileWithOptions with parser.DefaultParserOptions.
+func Compile(str string) (*Selector, error) {
+	return CompileWithOptions(str, parser.ParserOptions{})
+}
+
+func CompileWithOptions(str string, opts parser.ParserOptions) (*Selector, error) {
+	ast, err := parser.NewParserWithOptions(str, opts).Parse()
+	if err != nil {
+		return nil, syntaxError(err)
+	}
+	query, err := node.NewQuery(ast)
+	if err != nil {
+		return nil, syntaxError(err)
+	}
+	return &Selector{str: str, ast: ast, query: query}, nil
+}
+
+func MustCompile(str string) *Selector {
+	s, err := Compile(str)
+	if err != nil {
+		panic("selector: Compile(" + str + "): " + err.Error())
+	}
+	return s
+}
+
+func (s *Selector) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.str
+}
+
+func (s *Selector) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Selector) UnmarshalText(text []byte) error {
+	c, err := Compile(string(text))
+	if err != nil {
+		return err
+	}
+	*s = *c
+	return nil
+}
+
+// Set implements flag.Value.
+func (s *Selector) Set(str string) error {
+	return s.UnmarshalText([]byte(str))
+}
@@ -0,0 +1,129 @@
+package selector
+
+import (
+	"cmp"
+	"sort"
+
+	"github.com/SteveZhangBit/leiogo-css/node"
+)
+
+// Each calls f with the position of every node and the node alone, until f
+// returns false. It returns e.
+func (e *Elements) Each(f func(i int, el *Elements) bool) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	for i, n := range e.Nodes {
+		if !f(i, e.derive(item(i), []*node.Node{n})) {
+			break
+		}
+	}
+	return e
+}
+
+// Eq returns the i-th node alone, counting from the end if i is negative,
+// or an empty set if i is out of range.
+func (e *Elements) Eq(i int) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	if i < 0 {
+		i += len(e.Nodes)
+	}
+	if i < 0 || i >= len(e.Nodes) {
+		return e.derive(item(i), []*node.Node{})
+	}
+	return e.derive(item(i), []*node.Node{e.Nodes[i]})
+}
+
+// Slice returns the nodes from start up to but not including end. Negative
+// positions count from the end, and both are clamped to the set.
+func (e *Elements) Slice(start, end int) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	clamp := func(i int) int {
+		if i < 0 {
+			i += len(e.Nodes)
+		}
+		return max(0, min(i, len(e.Nodes)))
+	}
+	op := call("Slice", start, end)
+	start, end = clamp(start), clamp(end)
+	if start >= end {
+		return e.derive(op, []*node.Node{})
+	}
+	return e.derive(op, append([]*node.Node{}, e.Nodes[start:end]...))
+}
+
+// Len returns the number of nodes, or 0 if e holds an error.
+func (e *Elements) Len() int {
+	if e.Err != nil {
+		return 0
+	}
+	return len(e.Nodes)
+}
+
+// End returns the set e was derived from, or an empty set if there is
+// none, like jQuery's end.
+func (e *Elements) End() *Elements {
+	if e.prev == nil {
+		return &Elements{Nodes: []*node.Node{}}
+	}
+	return e.prev
+}
+
+// Map calls f with the position of every node of e and the node alone, and
+// returns the results.
+func Map[T any](e *Elements, f func(i int, el *Elements) T) []T {
+	if e.Err != nil {
+		return nil
+	}
+	out := make([]T, 0, len(e.Nodes))
+	for i, n := range e.Nodes {
+		out = append(out, f(i, e.derive(item(i), []*node.Node{n})))
+	}
+	return out
+}
+
+// Reduce folds the nodes of e into acc, from first to last.
+func Reduce[T any](e *Elements, acc T, f func(acc T, i int, el *Elements) T) T {
+	if e.Err != nil {
+		return acc
+	}
+	for i, n := range e.Nodes {
+		acc = f(acc, i, e.derive(item(i), []*node.Node{n}))
+	}
+	return acc
+}
+
+// GroupBy splits the nodes of e by key. Every group keeps the order of e.
+func GroupBy[K comparable](e *Elements, key func(i int, el *Elements) K) map[K]*Elements {
+	groups := map[K]*Elements{}
+	if e.Err != nil {
+		return groups
+	}
+	for i, n := range e.Nodes {
+		k := key(i, e.derive(item(i), []*node.Node{n}))
+		if groups[k] == nil {
+			groups[k] = e.derive(call("GroupBy", k), []*node.Node{})
+		}
+		groups[k].Nodes = append(groups[k].Nodes, n)
+	}
+	return groups
+}
+
+// SortBy returns the nodes of e ordered by key. Nodes with equal keys keep
+// their order.
+func SortBy[K cmp.Ordered](e *Elements, key func(el *Elements) K) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	nodes := append([]*node.Node{}, e.Nodes...)
+	keys := make(map[*node.Node]K, len(nodes))
+	for i, n := range nodes {
+		keys[n] = key(e.derive(item(i), []*node.Node{n}))
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return cmp.Less(keys[nodes[i]], keys[nodes[j]]) })
+	return e.derive(call("SortBy"), nodes)
+}
@@ -0,0 +1,124 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/SteveZhangBit/leiogo-css/parser"
+)
+
+var (
+	// ErrEmpty is returned when an operation needs a node and the set is
+	// empty.
+	ErrEmpty = errors.New("empty set")
+	// ErrOutOfRange is returned for an index outside of the set.
+	ErrOutOfRange = errors.New("index out of range")
+	// ErrSyntax is returned for selectors that cannot be parsed or are not
+	// supported. Parser limits are reported with parser.ErrLimitExceeded
+	// instead.
+	ErrSyntax = errors.New("invalid selector")
+	// ErrNoAttr is returned by AttrE when the attribute is missing.
+	ErrNoAttr = errors.New("no such attribute")
+)
+
+// ChainError is an error from an operation on Elements, together with the
+// operations that led to it, so that
+//
+//	doc.Find("#post a").First()
+//
+// fails with `Find("#post a") → First(): empty set`. errors.Is and
+// errors.As see the underlying error.
+type ChainError struct {
+	Ops []string
+	Err error
+}
+
+func (e *ChainError) Error() string {
+	return strings.Join(e.Ops, " → ") + ": " + e.Err.Error()
+}
+
+func (e *ChainError) Unwrap() error {
+	return e.Err
+}
+
+// Must returns e, or panics if e holds an error.
+func (e *Elements) Must() *Elements {
+	if e.Err != nil {
+		panic(e.Err)
+	}
+	return e
+}
+
+// Must returns v, or panics if err is not nil. It is meant for the checked
+// accessors, as in Must(doc.Find("title").TextE()).
+func Must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// fail returns a set that holds err, raised by op on e.
+func (e *Elements) fail(op operation, err error) *Elements {
+	return &Elements{Err: e.wrap(op, err), prev: e, op: op}
+}
+
+// wrap adds the chain of operations up to e and op to err.
+func (e *Elements) wrap(op operation, err error) error {
+	return &ChainError{Ops: append(e.chain(), op.String()), Err: err}
+}
+
+// chain returns the operations that produced e, first to last.
+func (e *Elements) chain() []string {
+	ops := []string{}
+	for x := e; x != nil; x = x.prev {
+		if x.op.name != "" {
+			ops = append(ops, x.op.String())
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// operation is a step of a chain, kept for ChainError. It is only
+// formatted when an error is reported, not every time a set is derived.
+type operation struct {
+	name string
+	args []interface{}
+}
+
+// String formats the operation as a call: strings are quoted and other
+// arguments printed as with %v.
+func (o operation) String() string {
+	parts := make([]string, len(o.args))
+	for i, arg := range o.args {
+		if s, ok := arg.(string); ok {
+			parts[i] = strconv.Quote(s)
+		} else {
+			parts[i] = fmt.Sprint(arg)
+		}
+	}
+	return o.name + "(" + strings.Join(parts, ", ") + ")"
+}
+
+func call(name string, args ...interface{}) operation {
+	return operation{name: name, args: args}
+}
+
+// item names the single node sets handed out by Each, Map and the like.
+func item(i int) operation {
+	return call("Eq", i)
+}
+
+// syntaxError marks err from compiling a selector with ErrSyntax, unless it
+// is a parser limit.
+func syntaxError(err error) error {
+	if err == nil || errors.Is(err, ErrSyntax) || errors.Is(err, parser.ErrLimitExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrSyntax, err)
+}
@@ -0,0 +1,109 @@
+package selector
+
+import (
+	"github.com/SteveZhangBit/leiogo-css/node"
+)
+
+// Filter returns the nodes of e that match str. Unlike Find, the
+// combinators of str may reach anywhere in the document, so "div > p"
+// keeps every p whose parent is a div.
+func (e *Elements) Filter(str string) *Elements {
+	return e.queryHelper(call("Filter", str), str, func(op operation, q *node.Query) *Elements {
+		return e.filter(op, func(n *node.Node) bool { return q.Match(n, nil) })
+	})
+}
+
+// Not returns the nodes of e that do not match str, with the semantics of
+// Filter.
+func (e *Elements) Not(str string) *Elements {
+	return e.queryHelper(call("Not", str), str, func(op operation, q *node.Query) *Elements {
+		return e.filter(op, func(n *node.Node) bool { return !q.Match(n, nil) })
+	})
+}
+
+// Is reports whether any node of e matches str, with the semantics of
+// Filter. It is false if str is not a valid selector.
+func (e *Elements) Is(str string) bool {
+	is := false
+	e.queryHelper(call("Is", str), str, func(op operation, q *node.Query) *Elements {
+		for _, n := range e.Nodes {
+			if q.Match(n, nil) {
+				is = true
+				break
+			}
+		}
+		return e
+	})
+	return is
+}
+
+// Has returns the nodes of e that have a descendant Find(str) would
+// return.
+func (e *Elements) Has(str string) *Elements {
+	return e.queryHelper(call("Has", str), str, func(op operation, q *node.Query) *Elements {
+		return e.filter(op, q.Exists)
+	})
+}
+
+// Closest returns, for every node of e, the node itself or its nearest
+// ancestor that matches str, in document order and without duplicates.
+func (e *Elements) Closest(str string) *Elements {
+	return e.queryHelper(call("Closest", str), str, func(op operation, q *node.Query) *Elements {
+		nodes := []*node.Node{}
+		for _, n := range e.Nodes {
+			for p := n; p != nil; p = (*node.Node)(p.Parent) {
+				if q.Match(p, nil) {
+					nodes = append(nodes, p)
+					break
+				}
+			}
+		}
+		return e.derive(op, node.SortUnique(nodes))
+	})
+}
+
+// FilterFunc returns the nodes of e for which f returns true. f is called
+// with the position of the node in e and the node alone.
+func (e *Elements) FilterFunc(f func(i int, el *Elements) bool) *Elements {
+	return e.funcHelper(call("FilterFunc"), f, true)
+}
+
+// NotFunc returns the nodes of e for which f returns false.
+func (e *Elements) NotFunc(f func(i int, el *Elements) bool) *Elements {
+	return e.funcHelper(call("NotFunc"), f, false)
+}
+
+func (e *Elements) funcHelper(op operation, f func(i int, el *Elements) bool, keep bool) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	nodes := []*node.Node{}
+	for i, n := range e.Nodes {
+		if f(i, e.derive(item(i), []*node.Node{n})) == keep {
+			nodes = append(nodes, n)
+		}
+	}
+	return e.derive(op, nodes)
+}
+
+// queryHelper compiles str through the cache and hands its query to f.
+func (e *Elements) queryHelper(op operation, str string, f func(op operation, q *node.Query) *Elements) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	s, err := compile(str)
+	if err != nil {
+		return e.fail(op, err)
+	}
+	return f(op, s.query)
+}
+
+func (e *Elements) filter(op operation, f func(n *node.Node) bool) *Elements {
+	nodes := []*node.Node{}
+	for _, n := range e.Nodes {
+		if f(n) {
+			nodes = append(nodes, n)
+		}
+	}
+	return e.derive(op, nodes)
+}
@@ -0,0 +1,65 @@
+package selector
+
+import (
+	"io"
+
+	"github.com/SteveZhangBit/leiogo-css/node"
+)
+
+// Html returns the inner HTML of the first node.
+func (e *Elements) Html() string {
+	if len(e.Nodes) == 0 {
+		return ""
+	}
+	return e.Nodes[0].Html()
+}
+
+// OuterHtml returns the HTML of the first node itself.
+func (e *Elements) OuterHtml() string {
+	if len(e.Nodes) == 0 {
+		return ""
+	}
+	return e.Nodes[0].OuterHtml()
+}
+
+// Htmls returns the inner HTML of every node.
+func (e *Elements) Htmls() []string {
+	htmls := []string{}
+	for _, n := range e.Nodes {
+		htmls = append(htmls, n.Html())
+	}
+	return htmls
+}
+
+// OuterHtmls returns the HTML of every node itself.
+func (e *Elements) OuterHtmls() []string {
+	htmls := []string{}
+	for _, n := range e.Nodes {
+		htmls = append(htmls, n.OuterHtml())
+	}
+	return htmls
+}
+
+// Render writes the HTML of every node to w, one after another. When
+// indenting, each node starts on a new line.
+func (e *Elements) Render(w io.Writer) error {
+	return e.RenderWith(w, node.RenderOptions{})
+}
+
+// RenderWith is Render with pretty-printing or minifying options.
+func (e *Elements) RenderWith(w io.Writer, opts node.RenderOptions) error {
+	if e.Err != nil {
+		return e.Err
+	}
+	for i, n := range e.Nodes {
+		if i > 0 && opts.Indent != "" && !opts.Minify {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := n.Render(w, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package selector
+
+import (
+	"iter"
+
+	"github.com/SteveZhangBit/leiogo-css/node"
+)
+
+// All yields the position of every node and the node as a set of its own.
+// Nothing is yielded if e holds an error.
+func (e *Elements) All() iter.Seq2[int, *Elements] {
+	return func(yield func(int, *Elements) bool) {
+		if e.Err != nil {
+			return
+		}
+		for i, n := range e.Nodes {
+			if !yield(i, e.derive(item(i), []*node.Node{n})) {
+				return
+			}
+		}
+	}
+}
+
+// NodeSeq yields the nodes of e. It is not called Nodes because that is
+// the name of the field.
+func (e *Elements) NodeSeq() iter.Seq[*node.Node] {
+	return func(yield func(*node.Node) bool) {
+		if e.Err != nil {
+			return
+		}
+		for _, n := range e.Nodes {
+			if !yield(n) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SteveZhangBit/leiogo-css/node"
+	"golang.org/x/net/html"
+)
+
+// The methods below change the document in place and return e, so that
+// they can be chained. Content may be an HTML string, which is parsed
+// again for every target, an *Elements, a *node.Node or a []*node.Node.
+// Nodes given as content are moved to the last target and cloned for the
+// others, as in jQuery.
+
+// SetAttr sets the attribute name to val on every element.
+func (e *Elements) SetAttr(name, val string) *Elements {
+	return e.mutate(func(n *node.Node) {
+		if n.Type == html.ElementNode {
+			n.SetAttr(name, val)
+		}
+	})
+}
+
+// RemoveAttr removes the attribute name from every element.
+func (e *Elements) RemoveAttr(name string) *Elements {
+	return e.mutate(func(n *node.Node) { n.RemoveAttr(name) })
+}
+
+// SetText replaces the children of every node with the text.
+func (e *Elements) SetText(text string) *Elements {
+	return e.mutate(func(n *node.Node) {
+		if n.Type == html.TextNode {
+			n.Data = text
+		} else if container(n) != nil {
+			n.Empty()
+			n.AppendChild(&node.Node{Type: html.TextNode, Data: text})
+		}
+	})
+}
+
+// SetHtml replaces the children of every node with the parsed HTML.
+func (e *Elements) SetHtml(s string) *Elements {
+	return e.insert(call("SetHtml"), s, container, false, func(n *node.Node, nodes []*node.Node) {
+		n.Empty()
+		for _, c := range nodes {
+			n.AppendChild(c)
+		}
+	})
+}
+
+// Append adds content as the last children of every node.
+func (e *Elements) Append(content interface{}) *Elements {
+	return e.insert(call("Append"), content, container, false, func(n *node.Node, nodes []*node.Node) {
+		for _, c := range nodes {
+			n.AppendChild(c)
+		}
+	})
+}
+
+// Prepend adds content as the first children of every node.
+func (e *Elements) Prepend(content interface{}) *Elements {
+	return e.insert(call("Prepend"), content, container, false, func(n *node.Node, nodes []*node.Node) {
+		ref := (*node.Node)(n.FirstChild)
+		for _, c := range nodes {
+			n.InsertBefore(c, ref)
+		}
+	})
+}
+
+// Before inserts content before every node that has a parent.
+func (e *Elements) Before(content interface{}) *Elements {
+	return e.insert(call("Before"), content, parentOf, false, func(n *node.Node, nodes []*node.Node) {
+		for _, c := range nodes {
+			(*node.Node)(n.Parent).InsertBefore(c, n)
+		}
+	})
+}
+
+// After inserts content after every node that has a parent.
+func (e *Elements) After(content interface{}) *Elements {
+	return e.insert(call("After"), content, parentOf, false, func(n *node.Node, nodes []*node.Node) {
+		ref := (*node.Node)(n.NextSibling)
+		for _, c := range nodes {
+			(*node.Node)(n.Parent).InsertBefore(c, ref)
+		}
+	})
+}
+
+// ReplaceWith puts content in place of every node that has a parent, and
+// returns the removed nodes.
+func (e *Elements) ReplaceWith(content interface{}) *Elements {
+	return e.insert(call("ReplaceWith"), content, parentOf, false, func(n *node.Node, nodes []*node.Node) {
+		for _, c := range nodes {
+			(*node.Node)(n.Parent).InsertBefore(c, n)
+		}
+		n.Detach()
+	})
+}
+
+// Remove detaches every node from the document and returns them.
+func (e *Elements) Remove() *Elements {
+	return e.mutate(func(n *node.Node) { n.Detach() })
+}
+
+// Empty removes the children of every node.
+func (e *Elements) Empty() *Elements {
+	return e.mutate(func(n *node.Node) { n.Empty() })
+}
+
+// Wrap puts every node that has a parent inside its own copy of content.
+// The node goes into the innermost first element of the copy. The body and
+// html elements are never wrapped.
+func (e *Elements) Wrap(content interface{}) *Elements {
+	return e.insert(call("Wrap"), content, wrappable, true, func(n *node.Node, nodes []*node.Node) {
+		var wrapper *node.Node
+		for _, c := range nodes {
+			if c.Type == html.ElementNode {
+				wrapper = c
+				break
+			}
+		}
+		if wrapper == nil {
+			return
+		}
+		(*node.Node)(n.Parent).InsertBefore(wrapper, n)
+		inner := wrapper
+		for c := firstElement(inner); c != nil; c = firstElement(inner) {
+			inner = c
+		}
+		inner.AppendChild(n)
+	})
+}
+
+// Unwrap removes the parents of the nodes, leaving their children in their
+// place. The body and html elements are never removed.
+func (e *Elements) Unwrap() *Elements {
+	seen := map[*node.Node]bool{}
+	return e.mutate(func(n *node.Node) {
+		p := (*node.Node)(n.Parent)
+		if p == nil || p.Parent == nil || p.Type != html.ElementNode || p.Data == "body" || p.Data == "html" || seen[p] {
+			return
+		}
+		seen[p] = true
+		for c := (*node.Node)(p.FirstChild); c != nil; c = (*node.Node)(p.FirstChild) {
+			(*node.Node)(p.Parent).InsertBefore(c, p)
+		}
+		p.Detach()
+	})
+}
+
+// Clone returns deep copies of the nodes, outside of any document.
+func (e *Elements) Clone() *Elements {
+	if e.Err != nil {
+		return e
+	}
+	nodes := []*node.Node{}
+	for _, n := range e.Nodes {
+		nodes = append(nodes, n.Clone())
+	}
+	return &Elements{Nodes: nodes, prev: e, op: call("Clone")}
+}
+
+func (e *Elements) mutate(f func(n *node.Node)) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	for _, n := range e.Nodes {
+		f(n)
+	}
+	e.Invalidate()
+	return e
+}
+
+// insert resolves content for every node n, in the context of context(n),
+// and hands the result to f, detached from where it was. Nodes for which
+// context returns nil are skipped, as are duplicates and nodes detached by
+// the time they are reached. With cloneAll the content is cloned for the
+// last node too.
+func (e *Elements) insert(op operation, content interface{}, context func(n *node.Node) *node.Node, cloneAll bool, f func(n *node.Node, nodes []*node.Node)) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	targets := []*node.Node{}
+	seen := map[*node.Node]bool{}
+	for _, n := range e.Nodes {
+		if context(n) != nil && !seen[n] {
+			seen[n] = true
+			targets = append(targets, n)
+		}
+	}
+	// An error on a later target leaves the earlier ones changed, so the
+	// index must be dropped on every path out once anything was touched.
+	touched := false
+	defer func() {
+		if touched {
+			e.Invalidate()
+		}
+	}()
+	for i, n := range targets {
+		if context(n) == nil {
+			continue
+		}
+		nodes, err := e.content(content, context(n), cloneAll || i < len(targets)-1)
+		if err != nil {
+			return e.fail(op, err)
+		}
+		moved := []*node.Node{}
+		for _, c := range nodes {
+			if c == n {
+				continue
+			}
+			if c.Contains(context(n)) {
+				return e.fail(op, errors.New("cannot insert a node into itself"))
+			}
+			moved = append(moved, c)
+		}
+		touched = true
+		for _, c := range moved {
+			c.Detach()
+		}
+		f(n, moved)
+	}
+	return e
+}
+
+func (e *Elements) content(content interface{}, context *node.Node, clone bool) ([]*node.Node, error) {
+	var nodes []*node.Node
+	switch x := content.(type) {
+	case string:
+		return node.ParseFragment(x, context)
+	case *Elements:
+		if x.Err != nil {
+			return nil, x.Err
+		}
+		x.Invalidate()
+		nodes = x.Nodes
+	case *node.Node:
+		nodes = []*node.Node{x}
+	case []*node.Node:
+		nodes = x
+	default:
+		return nil, fmt.Errorf("unsupported content: %T", content)
+	}
+	if !clone {
+		return nodes, nil
+	}
+	clones := make([]*node.Node, len(nodes))
+	for i, n := range nodes {
+		clones[i] = n.Clone()
+	}
+	return clones, nil
+}
+
+// Invalidate drops the index e shares with its document, if any, so that
+// it is rebuilt on the next Find or Select. The methods of Elements that
+// change the document call it themselves; call it after changing nodes
+// directly, as with node.Node.SetAttr, a node.ClassList or the fields of
+// html.Node, or indexed lookups may miss the changes.
+func (e *Elements) Invalidate() {
+	if e.index != nil {
+		e.index.Invalidate()
+	}
+}
+
+// container returns n if it can have children.
+func container(n *node.Node) *node.Node {
+	if n.Type == html.ElementNode || n.Type == html.DocumentNode {
+		return n
+	}
+	return nil
+}
+
+func parentOf(n *node.Node) *node.Node {
+	return (*node.Node)(n.Parent)
+}
+
+// wrappable returns the parent of n, unless n is the body or html element.
+func wrappable(n *node.Node) *node.Node {
+	if n.Type == html.ElementNode && (n.Data == "body" || n.Data == "html") {
+		return nil
+	}
+	return parentOf(n)
+}
+
+func firstElement(n *node.Node) *node.Node {
+	for c := (*node.Node)(n.FirstChild); c != nil; c = (*node.Node)(c.NextSibling) {
+		if c.Type == html.ElementNode {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package selector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FieldType is the kind of value a schema field extracts.
+type FieldType string
+
+const (
+	// TypeText is the trimmed text of the first match. It is the default.
+	TypeText FieldType = "text"
+	// TypeHtml is the inner HTML of the first match.
+	TypeHtml FieldType = "html"
+	// TypeAttr is the attribute Attr of the first match.
+	TypeAttr FieldType = "attr"
+	// TypeList is one value per match, each extracted with Item.
+	TypeList FieldType = "list"
+	// TypeObject is an object extracted with Fields from the first match.
+	TypeObject FieldType = "object"
+)
+
+// Schema describes what Extract takes from a document. It is usually
+// written as JSON and loaded with ParseSchema:
+//
+//	{
+//	  "fields": [
+//	    {"name": "title", "selector": "h1", "required": true},
+//	    {"name": "link", "selector": "a.buy", "type": "attr", "attr": "href"},
+//	    {"name": "body", "selector": ".body", "type": "html", "default": ""},
+//	    {"name": "tags", "selector": ".tags li", "type": "list"},
+//	    {"name": "reviews", "selector": ".review", "type": "list",
+//	     "item": {"type": "object", "fields": [
+//	       {"name": "stars", "selector": ".stars"},
+//	       {"name": "author", "selector": "a", "type": "attr", "attr": "title"}
+//	     ]}},
+//	    {"name": "seller", "selector": ".seller", "type": "object", "fields": [
+//	      {"name": "name", "selector": ".name"}
+//	    ]}
+//	  ]
+//	}
+type Schema struct {
+	Fields []*Field `json:"fields"`
+}
+
+// Field is one named value of a Schema.
+type Field struct {
+	// Name is the key of the value in the result. Item fields have none.
+	Name string `json:"name,omitempty"`
+	// Selector is run with Find on the enclosing element. An empty selector
+	// means the enclosing element itself, which is mostly useful for items.
+	Selector string    `json:"selector,omitempty"`
+	Type     FieldType `json:"type,omitempty"`
+	// Attr is the attribute read by TypeAttr fields.
+	Attr string `json:"attr,omitempty"`
+	// Item extracts every match of a TypeList field, with Selector scoped
+	// to the match. It defaults to the text of the match.
+	Item *Field `json:"item,omitempty"`
+	// Fields are the values of a TypeObject field, scoped to the match.
+	Fields []*Field `json:"fields,omitempty"`
+	// Default is the JSON value used when there is no value. It keeps its
+	// JSON type, so "default": 0 gives a float64 where extracted values are
+	// strings. "default": null is a default too: the field is nil but it is
+	// reported as defaulted rather than missing.
+	Default json.RawMessage `json:"default,omitempty"`
+	// Required fields with no value and no default are reported as errors.
+	Required bool `json:"required,omitempty"`
+}
+
+// ParseSchema reads a schema from JSON. Unknown keys are rejected and the
+// schema is checked with Validate.
+func ParseSchema(data []byte) (*Schema, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	s := &Schema{}
+	if err := dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("selector: schema: %w", err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate checks that every field has a known type with what it needs,
+// that names are set and unique among their siblings, and that the
+// selectors compile and the defaults are valid JSON.
+func (s *Schema) Validate() error {
+	if s == nil {
+		return errors.New("selector: schema: nil schema")
+	}
+	return validateFields(s.Fields, "")
+}
+
+func validateFields(fields []*Field, path string) error {
+	names := map[string]bool{}
+	for i, f := range fields {
+		if f == nil || f.Name == "" {
+			return fmt.Errorf("selector: schema: field %s has no name", join(path, fmt.Sprintf("#%d", i)))
+		}
+		if names[f.Name] {
+			return fmt.Errorf("selector: schema: duplicate field %q", join(path, f.Name))
+		}
+		names[f.Name] = true
+		if err := f.validate(join(path, f.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Field) validate(path string) error {
+	if f.Default != nil && !json.Valid(f.Default) {
+		return fmt.Errorf("selector: schema: %s: default is not valid JSON", path)
+	}
+	if f.Selector != "" {
+		if _, err := Compile(f.Selector); err != nil {
+			return fmt.Errorf("selector: schema: %s: %w", path, err)
+		}
+	}
+	switch f.Type {
+	case "", TypeText, TypeHtml:
+	case TypeAttr:
+		if f.Attr == "" {
+			return fmt.Errorf("selector: schema: %s: attr field without an attr", path)
+		}
+	case TypeList:
+		if f.Item != nil {
+			return f.Item.validate(path + "[]")
+		}
+	case TypeObject:
+		if len(f.Fields) == 0 {
+			return fmt.Errorf("selector: schema: %s: object field without fields", path)
+		}
+		return validateFields(f.Fields, path)
+	default:
+		return fmt.Errorf("selector: schema: %s: unknown type %q", path, f.Type)
+	}
+	return nil
+}
+
+// Report tells how well a document matched a schema.
+type Report struct {
+	// Errors are *UnmarshalError values for the required fields that had
+	// no value and for the selectors that failed.
+	Errors []error
+	// Defaulted lists the fields that had no value and took their default.
+	Defaulted []string
+}
+
+// Valid reports whether extraction had no errors.
+func (r *Report) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Err returns the errors joined together, or nil.
+func (r *Report) Err() error {
+	return errors.Join(r.Errors...)
+}
+
+// Extract takes the fields of schema from doc. The result holds a value
+// for every field, so that it can be encoded as JSON: strings for text,
+// html and attr fields, slices for lists and maps for objects. Fields with
+// no value take their default, or are nil, and empty lists are empty
+// slices. Problems do not stop extraction; they are collected in the
+// report. A schema that fails Validate, or a doc holding an error, gives
+// an empty result with that error.
+func Extract(doc *Elements, schema *Schema) (map[string]interface{}, *Report) {
+	r := &Report{}
+	if err := schema.Validate(); err != nil {
+		r.Errors = append(r.Errors, err)
+		return map[string]interface{}{}, r
+	}
+	if doc.Err != nil {
+		r.Errors = append(r.Errors, doc.Err)
+		return map[string]interface{}{}, r
+	}
+	return r.object(doc, schema.Fields, ""), r
+}
+
+func (r *Report) object(el *Elements, fields []*Field, path string) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		m[f.Name] = r.field(el, f, join(path, f.Name))
+	}
+	return m
+}
+
+func (r *Report) field(el *Elements, f *Field, path string) interface{} {
+	matches := el
+	if strings.TrimSpace(f.Selector) != "" {
+		matches = el.Find(f.Selector)
+	}
+	if matches.Err != nil {
+		r.Errors = append(r.Errors, &UnmarshalError{Field: path, Selector: f.Selector, Err: matches.Err})
+		return f.defaultValue()
+	}
+
+	if f.Type == TypeList {
+		if len(matches.Nodes) == 0 {
+			return r.missing(f, path, ErrEmpty, []interface{}{})
+		}
+		item := f.Item
+		if item == nil {
+			item = &Field{}
+		}
+		list := make([]interface{}, 0, len(matches.Nodes))
+		for i, m := range matches.Iterator() {
+			list = append(list, r.field(m, item, fmt.Sprintf("%s[%d]", path, i)))
+		}
+		return list
+	}
+
+	if len(matches.Nodes) == 0 {
+		return r.missing(f, path, ErrEmpty, nil)
+	}
+	first := matches.First()
+	switch f.Type {
+	case TypeHtml:
+		return first.Html()
+	case TypeAttr:
+		if v, ok := first.AttrOk(f.Attr); ok {
+			return v
+		}
+		return r.missing(f, path, fmt.Errorf("%w %q", ErrNoAttr, f.Attr), nil)
+	case TypeObject:
+		return r.object(first, f.Fields, path)
+	default:
+		return strings.TrimSpace(first.Text())
+	}
+}
+
+// missing returns the value of f when it has none, and records why.
+func (r *Report) missing(f *Field, path string, err error, zero interface{}) interface{} {
+	if f.Default != nil {
+		r.Defaulted = append(r.Defaulted, path)
+		return f.defaultValue()
+	}
+	if f.Required {
+		r.Errors = append(r.Errors, &UnmarshalError{Field: path, Selector: f.Selector, Err: err})
+	}
+	return zero
+}
+
+// defaultValue decodes the default of f, which Validate checked.
+func (f *Field) defaultValue() interface{} {
+	var v interface{}
+	json.Unmarshal(f.Default, &v)
+	return v
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -1,8 +1,9 @@
 package selector
 
 import (
-	"errors"
 	"fmt"
+	"io"
+	"slices"
 	"strings"
 
 	"github.com/SteveZhangBit/leiogo-css/node"
@@ -10,9 +11,21 @@ import (
 	"golang.org/x/net/html"
 )
 
+// Elements is a set of nodes, or the error that prevented computing it.
+// Operations never change an Elements: they return a new one, or e itself
+// when e already holds an error, so a set can be shared and reused. The
+// exceptions are the methods that change the document, which return e so
+// that they can be chained. Errors are *ChainError values naming the
+// operations that led to them.
 type Elements struct {
 	Nodes []*node.Node
 	Err   error
+	// index is shared by every set derived from an indexed document.
+	index *node.Index
+	// prev is the set e was derived from, for End, and op the operation
+	// that derived it, for errors.
+	prev *Elements
+	op   operation
 }
 
 func Parse(body string) *Elements {
@@ -23,100 +36,287 @@ func Parse(body string) *Elements {
 	}
 }
 
-func (e *Elements) selectorHelper(str string, f func(ast parser.AST) *Elements) *Elements {
-	if e.Err != nil {
+// WithIndex returns e backed by an index of the document its first node
+// belongs to. Find and Select on it and on every set derived from it look
+// up candidates by id, class, tag or attribute name instead of walking the
+// tree. Changes made to nodes directly rather than through Elements need a
+// call to Invalidate.
+func (e *Elements) WithIndex() *Elements {
+	if e.Err != nil || len(e.Nodes) == 0 {
 		return e
 	}
-	if ast, err := parser.NewParser(str).Parse(); err != nil {
-		e.Err = err
-		return e
-	} else {
-		return f(ast)
+	root := e.Nodes[0]
+	for root.Parent != nil {
+		root = (*node.Node)(root.Parent)
 	}
+	return &Elements{Nodes: e.Nodes, index: node.NewIndex(root), prev: e.prev, op: e.op}
+}
+
+// derive returns the set of nodes produced by op on e. It keeps the index
+// of e and remembers e as the previous set.
+func (e *Elements) derive(op operation, nodes []*node.Node) *Elements {
+	return &Elements{Nodes: nodes, index: e.index, prev: e, op: op}
 }
 
+// Iterator returns every node as a set of its own. All does the same
+// lazily.
 func (e *Elements) Iterator() (iter []*Elements) {
 	if e.Err != nil {
 		return
 	}
-	for _, n := range e.Nodes {
-		iter = append(iter, &Elements{Nodes: []*node.Node{n}})
+	for i, n := range e.Nodes {
+		iter = append(iter, e.derive(item(i), []*node.Node{n}))
 	}
 	return
 }
 
+// Get returns the i-th node alone, or fails with ErrOutOfRange.
 func (e *Elements) Get(i int) *Elements {
 	if e.Err != nil {
 		return e
 	}
-	if i < len(e.Nodes) {
-		return &Elements{Nodes: []*node.Node{e.Nodes[i]}}
-	} else {
-		e.Err = errors.New(fmt.Sprintf("Get index %d out of range %d", i, len(e.Nodes)))
-		return e
+	op := call("Get", i)
+	if i < 0 || i >= len(e.Nodes) {
+		return e.fail(op, fmt.Errorf("%w: %d of %d", ErrOutOfRange, i, len(e.Nodes)))
 	}
+	return e.derive(op, []*node.Node{e.Nodes[i]})
 }
 
+// First returns the first node alone, or fails with ErrEmpty.
 func (e *Elements) First() *Elements {
 	if e.Err != nil {
 		return e
 	}
-	if len(e.Nodes) > 0 {
-		return &Elements{Nodes: []*node.Node{e.Nodes[0]}}
-	} else {
-		e.Err = errors.New("The list is empty")
-		return e
+	if len(e.Nodes) == 0 {
+		return e.fail(call("First"), ErrEmpty)
 	}
+	return e.derive(call("First"), []*node.Node{e.Nodes[0]})
 }
 
+// Last returns the last node alone, or fails with ErrEmpty.
 func (e *Elements) Last() *Elements {
 	if e.Err != nil {
 		return e
 	}
-	if len(e.Nodes) > 0 {
-		return &Elements{Nodes: []*node.Node{e.Nodes[len(e.Nodes)-1]}}
-	} else {
-		e.Err = errors.New("The list is empty")
-		return e
+	if len(e.Nodes) == 0 {
+		return e.fail(call("Last"), ErrEmpty)
 	}
+	return e.derive(call("Last"), []*node.Node{e.Nodes[len(e.Nodes)-1]})
 }
 
+// Find returns the descendants of the nodes in e that match str, in
+// document order and without duplicates.
 func (e *Elements) Find(str string) *Elements {
-	return e.selectorHelper(str, e.find)
+	if e.Err != nil {
+		return e
+	}
+	s, err := compile(str)
+	if err != nil {
+		return e.fail(call("Find", str), err)
+	}
+	return e.derive(call("Find", str), s.query.FindIndexed(e.index, e.Nodes...))
 }
 
-func (e *Elements) Child(str string) *Elements {
-	return e.selectorHelper(str, e.child)
+// Select is Find with a compiled selector.
+func (e *Elements) Select(s *Selector) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	return e.derive(call("Select", s.String()), s.query.FindIndexed(e.index, e.Nodes...))
+}
+
+// FindForgiving is like Find, but invalid branches of a selector list are
+// skipped and reported instead of failing the whole query.
+func (e *Elements) FindForgiving(str string) (*Elements, []parser.Diagnostic) {
+	if e.Err != nil {
+		return e, nil
+	}
+	op := call("FindForgiving", str)
+	ast, diags := parser.NewParser(str).ParseForgiving()
+	if ast == nil {
+		return e.derive(op, []*node.Node{}), diags
+	}
+	query, err := node.NewQuery(ast)
+	if err != nil {
+		return e.fail(op, syntaxError(err)), diags
+	}
+	return e.derive(op, query.FindIndexed(e.index, e.Nodes...)), diags
 }
 
-func (e *Elements) Not(str string) *Elements {
-	return e.selectorHelper(str, e.not)
+// The traversal methods below keep the candidates that match str, with
+// the semantics of Filter: combinators may reach anywhere in the
+// document, so Parents("div > section") returns every ancestor section
+// whose parent is a div. An empty str keeps every element. As in jQuery,
+// every element is returned once, and the results of several nodes are in
+// document order, or in reverse document order for Parents, PrevAll and
+// their Until forms.
+
+// Child returns the element children of every node that match str.
+func (e *Elements) Child(str string) *Elements {
+	return e.traverse(call("Child", str), str, false, func(n *node.Node, f func(c *node.Node)) {
+		for c := (*node.Node)(n.FirstChild); c != nil; c = (*node.Node)(c.NextSibling) {
+			f(c)
+		}
+	})
 }
 
+// Next returns the next element sibling of every node if it matches str.
 func (e *Elements) Next(str string) *Elements {
-	return e.selectorHelper(str, e.next)
+	return e.traverse(call("Next", str), str, false, func(n *node.Node, f func(c *node.Node)) {
+		for s := (*node.Node)(n.NextSibling); s != nil; s = (*node.Node)(s.NextSibling) {
+			if s.Type == html.ElementNode {
+				f(s)
+				return
+			}
+		}
+	})
 }
 
+// NextAll returns the following element siblings of every node that match
+// str.
 func (e *Elements) NextAll(str string) *Elements {
-	return e.selectorHelper(str, e.nextAll)
+	return e.traverse(call("NextAll", str), str, false, func(n *node.Node, f func(c *node.Node)) {
+		for s := (*node.Node)(n.NextSibling); s != nil; s = (*node.Node)(s.NextSibling) {
+			f(s)
+		}
+	})
 }
 
+// Prev returns the previous element sibling of every node if it matches
+// str.
 func (e *Elements) Prev(str string) *Elements {
-	return e.selectorHelper(str, e.prev)
+	return e.traverse(call("Prev", str), str, false, func(n *node.Node, f func(c *node.Node)) {
+		for s := (*node.Node)(n.PrevSibling); s != nil; s = (*node.Node)(s.PrevSibling) {
+			if s.Type == html.ElementNode {
+				f(s)
+				return
+			}
+		}
+	})
 }
 
+// PrevAll returns the preceding element siblings of every node that match
+// str, nearest first, or in reverse document order from several nodes.
 func (e *Elements) PrevAll(str string) *Elements {
-	return e.selectorHelper(str, e.prevAll)
+	return e.traverse(call("PrevAll", str), str, true, func(n *node.Node, f func(c *node.Node)) {
+		for s := (*node.Node)(n.PrevSibling); s != nil; s = (*node.Node)(s.PrevSibling) {
+			f(s)
+		}
+	})
 }
 
+// Parent returns the parent of every node if it matches str.
 func (e *Elements) Parent(str string) *Elements {
-	return e.selectorHelper(str, e.parent)
+	return e.traverse(call("Parent", str), str, false, func(n *node.Node, f func(c *node.Node)) {
+		if p := (*node.Node)(n.Parent); p != nil {
+			f(p)
+		}
+	})
 }
 
+// Parents returns the ancestors of every node that match str, nearest
+// first, or in reverse document order from several nodes.
 func (e *Elements) Parents(str string) *Elements {
-	return e.selectorHelper(str, e.parents)
+	return e.traverse(call("Parents", str), str, true, func(n *node.Node, f func(c *node.Node)) {
+		for p := (*node.Node)(n.Parent); p != nil; p = (*node.Node)(p.Parent) {
+			f(p)
+		}
+	})
+}
+
+// Children is Child under its jQuery name.
+func (e *Elements) Children(str string) *Elements {
+	return e.traverse(call("Children", str), str, false, func(n *node.Node, f func(c *node.Node)) {
+		for c := (*node.Node)(n.FirstChild); c != nil; c = (*node.Node)(c.NextSibling) {
+			f(c)
+		}
+	})
+}
+
+// Siblings returns the element siblings of every node that match str, in
+// document order and without duplicates. A node is not its own sibling,
+// but it is the sibling of another node of e. Each parent is visited once.
+func (e *Elements) Siblings(str string) *Elements {
+	// only maps each parent to its single node in e, or to nil if e holds
+	// several of its children.
+	only := map[*html.Node]*node.Node{}
+	for _, n := range e.Nodes {
+		if n.Parent == nil {
+			continue
+		}
+		if c, ok := only[n.Parent]; !ok {
+			only[n.Parent] = n
+		} else if c != n {
+			only[n.Parent] = nil
+		}
+	}
+	return e.traverse(call("Siblings", str), str, false, func(n *node.Node, f func(c *node.Node)) {
+		c, ok := only[n.Parent]
+		if !ok {
+			return
+		}
+		delete(only, n.Parent)
+		for s := (*node.Node)(n.Parent.FirstChild); s != nil; s = (*node.Node)(s.NextSibling) {
+			if s != c {
+				f(s)
+			}
+		}
+	})
+}
+
+// Contents returns the children of every node, including text and comment
+// nodes.
+func (e *Elements) Contents() *Elements {
+	if e.Err != nil {
+		return e
+	}
+	nodes := []*node.Node{}
+	for _, n := range e.Nodes {
+		for c := (*node.Node)(n.FirstChild); c != nil; c = (*node.Node)(c.NextSibling) {
+			nodes = append(nodes, c)
+		}
+	}
+	return e.derive(call("Contents"), nodes)
+}
+
+// ParentsUntil is Parents, stopping before the first ancestor that matches
+// until. An empty until goes up to the root.
+func (e *Elements) ParentsUntil(until, str string) *Elements {
+	return e.untilHelper(call("ParentsUntil", until, str), until, str, true, func(n *node.Node) *node.Node { return (*node.Node)(n.Parent) })
+}
+
+// NextUntil is NextAll, stopping before the first sibling that matches
+// until.
+func (e *Elements) NextUntil(until, str string) *Elements {
+	return e.untilHelper(call("NextUntil", until, str), until, str, false, func(n *node.Node) *node.Node { return (*node.Node)(n.NextSibling) })
+}
+
+// PrevUntil is PrevAll, stopping before the first sibling that matches
+// until.
+func (e *Elements) PrevUntil(until, str string) *Elements {
+	return e.untilHelper(call("PrevUntil", until, str), until, str, true, func(n *node.Node) *node.Node { return (*node.Node)(n.PrevSibling) })
+}
+
+func (e *Elements) untilHelper(op operation, until, str string, reverse bool, step func(n *node.Node) *node.Node) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	stop := func(n *node.Node) bool { return false }
+	if strings.TrimSpace(until) != "" {
+		var err error
+		if stop, err = matcher(until); err != nil {
+			return e.fail(op, err)
+		}
+	}
+	return e.traverse(op, str, reverse, func(n *node.Node, f func(c *node.Node)) {
+		for c := step(n); c != nil && !stop(c); c = step(c) {
+			f(c)
+		}
+	})
 }
 
+// Text returns the text of the first node, or "" if there is none or e
+// holds an error. TextE tells these cases apart.
 func (e *Elements) Text() string {
 	if len(e.Nodes) == 0 {
 		return ""
@@ -125,6 +325,17 @@ func (e *Elements) Text() string {
 	}
 }
 
+// TextE is Text that returns the error of e, or fails with ErrEmpty.
+func (e *Elements) TextE() (string, error) {
+	if e.Err != nil {
+		return "", e.Err
+	}
+	if len(e.Nodes) == 0 {
+		return "", e.wrap(call("Text"), ErrEmpty)
+	}
+	return e.Nodes[0].Text(), nil
+}
+
 func (e *Elements) Texts() []string {
 	text := []string{}
 	for _, n := range e.Nodes {
@@ -133,92 +344,109 @@ func (e *Elements) Texts() []string {
 	return text
 }
 
-func (e *Elements) Attr(name string) string {
+// TextWith returns the text of the first node extracted according to opts.
+func (e *Elements) TextWith(opts node.TextOptions) string {
 	if len(e.Nodes) == 0 {
 		return ""
-	} else {
-		return e.Nodes[0].GetAttr(name)
 	}
+	return e.Nodes[0].TextWith(opts)
 }
 
-func (e *Elements) Attrs(name string) []string {
-	attr := []string{}
+// TextsWith returns the text of every node extracted according to opts.
+func (e *Elements) TextsWith(opts node.TextOptions) []string {
+	text := []string{}
 	for _, n := range e.Nodes {
-		attr = append(attr, n.GetAttr(name))
+		text = append(text, n.TextWith(opts))
 	}
-	return attr
+	return text
 }
 
-func (e *Elements) find(ast parser.AST) *Elements {
-	nodes := []*node.Node{}
-	switch x := ast.(type) {
-	case parser.Selector:
-		for _, exp := range x.Seq {
-			nodes = append(nodes, e.find(exp).Nodes...)
-		}
-	case parser.Exp:
-		E := e.find(x.E)
-		switch x.Op {
-		case " ":
-			return E.find(x.F)
-		case ">":
-			return E.child(x.F)
-		case "+":
-			return E.next(x.F)
-		case "~":
-			return E.nextAll(x.F)
-		}
-	case parser.Element:
-		for _, n := range e.Nodes {
-			nodes = append(nodes, node.Find(n, x)...)
-		}
+// WriteText streams the text of every node to w, one after another.
+func (e *Elements) WriteText(w io.Writer, opts node.TextOptions) error {
+	if e.Err != nil {
+		return e.Err
 	}
-	return &Elements{Nodes: nodes}
-}
-
-func (e *Elements) selectorHelper2(ast parser.AST, f func(n *node.Node, query parser.Element) []*node.Node) *Elements {
-	nodes := []*node.Node{}
-	switch x := ast.(type) {
-	case parser.Selector:
-		for _, exp := range x.Seq {
-			nodes = append(nodes, e.selectorHelper2(exp, f).Nodes...)
-		}
-	case parser.Element:
-		for _, n := range e.Nodes {
-			nodes = append(nodes, f(n, x)...)
+	for _, n := range e.Nodes {
+		if err := n.WriteText(w, opts); err != nil {
+			return err
 		}
 	}
-	return &Elements{Nodes: nodes}
-}
-
-func (e *Elements) child(ast parser.AST) *Elements {
-	return e.selectorHelper2(ast, node.Child)
+	return nil
 }
 
-func (e *Elements) not(ast parser.AST) *Elements {
-	return e.selectorHelper2(ast, node.Not)
-}
-
-func (e *Elements) next(ast parser.AST) *Elements {
-	return e.selectorHelper2(ast, node.Next)
-}
-
-func (e *Elements) nextAll(ast parser.AST) *Elements {
-	return e.selectorHelper2(ast, node.NextAll)
+// Attr returns the attribute name of the first node, or "" if there is
+// none, it is missing or e holds an error. AttrE tells these cases apart.
+func (e *Elements) Attr(name string) string {
+	if len(e.Nodes) == 0 {
+		return ""
+	} else {
+		return e.Nodes[0].GetAttr(name)
+	}
 }
 
-func (e *Elements) prev(ast parser.AST) *Elements {
-	return e.selectorHelper2(ast, node.Prev)
+// AttrE is Attr that returns the error of e, or fails with ErrEmpty or
+// ErrNoAttr.
+func (e *Elements) AttrE(name string) (string, error) {
+	if e.Err != nil {
+		return "", e.Err
+	}
+	if len(e.Nodes) == 0 {
+		return "", e.wrap(call("Attr", name), ErrEmpty)
+	}
+	if !e.Nodes[0].HasAttr(name) {
+		return "", e.wrap(call("Attr", name), ErrNoAttr)
+	}
+	return e.Nodes[0].GetAttr(name), nil
 }
 
-func (e *Elements) prevAll(ast parser.AST) *Elements {
-	return e.selectorHelper2(ast, node.PrevAll)
+func (e *Elements) Attrs(name string) []string {
+	attr := []string{}
+	for _, n := range e.Nodes {
+		attr = append(attr, n.GetAttr(name))
+	}
+	return attr
 }
 
-func (e *Elements) parent(ast parser.AST) *Elements {
-	return e.selectorHelper2(ast, node.Parent)
+// traverse calls walk on every node of e to visit its candidates, and
+// keeps the elements among them that match str, once each. From a single
+// node they stay in the order walk visits them; from several they are put
+// in document order, or in reverse document order if reverse is set.
+func (e *Elements) traverse(op operation, str string, reverse bool, walk func(n *node.Node, f func(c *node.Node))) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	match, err := matcher(str)
+	if err != nil {
+		return e.fail(op, err)
+	}
+	nodes := []*node.Node{}
+	seen := map[*node.Node]bool{}
+	for _, n := range e.Nodes {
+		walk(n, func(c *node.Node) {
+			if c.Type == html.ElementNode && !seen[c] && match(c) {
+				seen[c] = true
+				nodes = append(nodes, c)
+			}
+		})
+	}
+	if len(e.Nodes) > 1 {
+		nodes = node.SortUnique(nodes)
+		if reverse {
+			slices.Reverse(nodes)
+		}
+	}
+	return e.derive(op, nodes)
 }
 
-func (e *Elements) parents(ast parser.AST) *Elements {
-	return e.selectorHelper2(ast, node.Parents)
+// matcher compiles str for matching anywhere in the document. An empty str
+// matches every node.
+func matcher(str string) (func(n *node.Node) bool, error) {
+	if strings.TrimSpace(str) == "" {
+		return func(n *node.Node) bool { return true }, nil
+	}
+	s, err := compile(str)
+	if err != nil {
+		return nil, err
+	}
+	return func(n *node.Node) bool { return s.query.Match(n, nil) }, nil
 }
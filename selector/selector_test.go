@@ -1,12 +1,21 @@
 package selector
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/SteveZhangBit/leiogo-css/node"
+	"github.com/SteveZhangBit/leiogo-css/parser"
 )
 
 func Test1(t *testing.T) {
-	if doc, err := Parse(
+	if doc := Parse(
 		`<div id="post">
 			<div class="cls links">
 				<a href="http://www.baidu.com">baidu</a>
@@ -19,10 +28,986 @@ func Test1(t *testing.T) {
 				<img src="/images/2.png">
 			</div>
 		</div>`,
-	); err != nil {
-		t.Error(err.Error())
+	); doc.Err != nil {
+		t.Error(doc.Err.Error())
 	} else {
 		el := doc.Find(`#post a`)
 		fmt.Println(el.Attr("href"))
 	}
 }
+
+func TestCompile(t *testing.T) {
+	doc := Parse(`<div id="post"><a href="/a">a</a><p><a href="/b">b</a></p></div>`)
+	s := MustCompile("#post a")
+	if got := doc.Select(s).Attrs("href"); len(got) != 2 {
+		t.Errorf("Get %v", got)
+	}
+	if _, err := Compile("#post a["); err == nil {
+		t.Error("Need a syntax error")
+	}
+
+	a, _ := compile("p > a")
+	b, _ := compile("p > a")
+	if a != b {
+		t.Error("Need a cached selector")
+	}
+
+	var conf struct{ Title *Selector }
+	if err := json.Unmarshal([]byte(`{"Title": "p a[href^=\"/\"]"}`), &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Title.String() != `p a[href^="/"]` || doc.Select(conf.Title).Text() != "b" {
+		t.Errorf("Get %v", conf.Title)
+	}
+	if err := json.Unmarshal([]byte(`{"Title": "p a["}`), &conf); err == nil {
+		t.Error("Need a syntax error")
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var f Selector
+	fs.Var(&f, "sel", "")
+	if err := fs.Parse([]string{"-sel", "div#post"}); err != nil || f.String() != "div#post" {
+		t.Errorf("Get %v, %v", f.String(), err)
+	}
+}
+
+func TestXPath(t *testing.T) {
+	doc := Parse(`<div id="post"><a href="/a">a</a><p><a href="/b">b</a></p></div><a href="/c">c</a>`)
+	if got := doc.Find("#post").XPath(".//a/@href").Texts(); fmt.Sprint(got) != "[/a /b]" {
+		t.Errorf("Get %v", got)
+	}
+	if got := doc.Find("a").XPath("ancestor::div").Nodes; len(got) != 1 {
+		t.Errorf("Get %v", got)
+	}
+	if v, err := doc.XPathValue("count(//a[starts-with(@href, '/')])"); err != nil || v != 3.0 {
+		t.Errorf("Get %v, %v", v, err)
+	}
+	if doc.XPath("count(//a)").Err == nil {
+		t.Error("Need an error for a scalar result")
+	}
+	if got := doc.Find("div, p").XPath(".//a/@href").Texts(); fmt.Sprint(got) != "[/a /b]" {
+		t.Errorf("Get %v", got)
+	}
+	got := doc.Find("a").Union(doc.XPath("//a/@href | //div/@id")).Sort()
+	if s := fmt.Sprint(got.Texts()); s != "[post a /a b /b c /c]" {
+		t.Errorf("Get %s", s)
+	}
+	i := Parse(`<i a="1" b="2">x</i>`)
+	if s := fmt.Sprint(i.XPath("//i/@b").Union(i.XPath("//text()")).Union(i.XPath("//i/@a | //i/@b")).Texts()); s != "[1 2 x]" {
+		t.Errorf("Get %s", s)
+	}
+	attrs := i.XPath("//@a | //@b")
+	if s := fmt.Sprint(attrs.Intersect(i.XPath("//@b")).Texts(), attrs.Difference(i.XPath("//@a")).Texts()); s != "[2] [2]" {
+		t.Errorf("Get %s", s)
+	}
+	if !i.XPath("//@a").IsSame(i.XPath("//@a")) || !attrs.Contains(i.XPath("//@b")) || attrs.IndexOf(i.XPath("//@b")) != 1 {
+		t.Error("attribute identity")
+	}
+}
+
+func TestCompileLimits(t *testing.T) {
+	long := strings.Repeat("a, ", 300) + "a"
+	if _, err := Compile(long); err != nil {
+		t.Error(err)
+	}
+	if err := Parse("<a>").Find(long).Err; err != nil {
+		t.Error(err)
+	}
+	if _, err := CompileWithOptions(long, parser.DefaultParserOptions); !errors.Is(err, parser.ErrLimitExceeded) {
+		t.Errorf("Get %v", err)
+	}
+	if _, err := CompileWithOptions("a.b.c", parser.ParserOptions{MaxCompound: 2}); !errors.Is(err, parser.ErrLimitExceeded) {
+		t.Errorf("Get %v", err)
+	}
+	for _, str := range []string{"a[x ]", "a[x y]", "p, a[x y]"} {
+		if _, err := Compile(str); !errors.Is(err, ErrSyntax) {
+			t.Errorf("%q: get %v", str, err)
+		}
+		if err := Parse("<a x>").Find(str).Err; !errors.Is(err, ErrSyntax) {
+			t.Errorf("%q: get %v", str, err)
+		}
+	}
+}
+
+func TestFindForgiving(t *testing.T) {
+	doc := Parse(`<p class="x"></p><a href="/"></a>`)
+	for _, str := range []string{"[href=, .x", "div >, .x", "a[x y], .x", "p:hover, .x"} {
+		el, diags := doc.FindForgiving(str)
+		if el.Err != nil || len(el.Nodes) != 1 || len(diags) != 1 {
+			t.Errorf("%q: get %v, %v", str, el.Nodes, diags)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	doc := Parse(`<div id="a" class=" x	y " title="" lang="en-US"><p data-n="12">p</p></div>`)
+	for sel, need := range map[string]int{
+		"DIV#a":              1,
+		"div.x.y":            1,
+		".y.z":               0,
+		"[TITLE]":            1,
+		"[title='']":         1,
+		"[title^='']":        0,
+		"[lang*='']":         0,
+		"[id='']":            0,
+		"p[data-n$=2]":       1,
+		"[data-n^=1][title]": 0,
+	} {
+		if got := len(doc.Find(sel).Nodes); got != need {
+			t.Errorf("%s: get %d, need %d", sel, got, need)
+		}
+	}
+}
+
+func TestFindOrder(t *testing.T) {
+	doc := Parse(`<div id="1"><div id="d2"><a id="3"></a><p id="4"></p><a id="5"></a></div></div><p id="6"></p><a id="7"></a>`)
+	for sel, need := range map[string]string{
+		"div div a":       "[3 5]",
+		"div a":           "[3 5]",
+		"a, p":            "[3 4 5 6 7]",
+		"p, #d2 > a, div": "[1 d2 3 4 5 6]",
+		"p ~ a":           "[5 7]",
+		"p + a":           "[5 7]",
+		" a , p ":         "[3 4 5 6 7]",
+	} {
+		if got := doc.Find(sel).Attrs("id"); fmt.Sprint(got) != need {
+			t.Errorf("%s: get %v, need %s", sel, got, need)
+		}
+	}
+	if got := doc.Find("div").Find("div a").Attrs("id"); fmt.Sprint(got) != "[3 5]" {
+		t.Errorf("Get %v", got)
+	}
+	if got := doc.Find("#d2").Find("div a").Attrs("id"); len(got) != 0 {
+		t.Errorf("Get %v", got)
+	}
+}
+
+func TestSet(t *testing.T) {
+	doc := Parse(`<ul><li id="a" class="x"></li><li id="b"></li><li id="c" class="x"></li></ul>`)
+	li, x := doc.Find("li"), doc.Find(".x")
+	b := doc.Find("#b")
+	for name, c := range map[string]struct {
+		got  *Elements
+		need string
+	}{
+		"union":      {x.Union(b), "[a b c]"},
+		"add":        {b.Add(x).Add(b), "[a b c]"},
+		"intersect":  {li.Intersect(x), "[a c]"},
+		"difference": {li.Difference(x), "[b]"},
+		"sort":       {doc.Find("#c").Union(b).Sort(), "[b c]"},
+	} {
+		if got := fmt.Sprint(c.got.Attrs("id")); got != c.need {
+			t.Errorf("%s: get %v, need %s", name, got, c.need)
+		}
+	}
+	if !li.Contains(x) || x.Contains(li) {
+		t.Error("Contains")
+	}
+	if !x.IsSame(doc.Find("#c, #a")) || x.IsSame(li) {
+		t.Error("IsSame")
+	}
+	if doc.Find("#c").Index() != 2 || li.IndexOf(b) != 1 || x.IndexOf(b) != -1 {
+		t.Error("Index")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	body := `<div id="main" class="x  y"><ul><li class="y">1</li><li DATA-K="v">2</li></ul><p class="x">3</p></div><div class="y"><span id="main">4</span></div>`
+	plain, indexed := Parse(body), Parse(body).WithIndex()
+	for _, sel := range []string{
+		"#main", ".y", ".x.y", "li", "[data-k]", "div .y", "ul > li + li", "div, .y, span",
+		"div > *", "p ~ *", "#main li", "DIV .X",
+	} {
+		need := plain.Find(sel).Texts()
+		if got := indexed.Find(sel).Texts(); fmt.Sprint(got) != fmt.Sprint(need) {
+			t.Errorf("%s: get %q, need %q", sel, got, need)
+		}
+		need = plain.Find("div").Find(sel).Texts()
+		if got := indexed.Find("div").Find(sel).Texts(); fmt.Sprint(got) != fmt.Sprint(need) {
+			t.Errorf("div %s: get %q, need %q", sel, got, need)
+		}
+	}
+
+	span := indexed.Find("span")
+	span.Nodes[0].Attr = nil
+	span.Invalidate()
+	if got := indexed.Find("#main").Texts(); fmt.Sprint(got) != "[123]" {
+		t.Errorf("Get %q", got)
+	}
+
+	span.Nodes[0].ClassList().Add("z")
+	indexed.Invalidate()
+	if got := indexed.Find(".z").Texts(); fmt.Sprint(got) != "[4]" {
+		t.Errorf("Get %q", got)
+	}
+}
+
+func nested(depth int) *Elements {
+	return Parse(strings.Repeat(`<div class="a"><span></span>`, depth) + strings.Repeat("</div>", depth))
+}
+
+func TestDeep(t *testing.T) {
+	doc := nested(300)
+	for sel, need := range map[string]int{
+		"body div div div span":           298,
+		"div.a > div > span":              299,
+		"html > div div div span":         0,
+		"section div span":                0,
+		"div + span, div span ~ div span": 299,
+	} {
+		if got := len(doc.Find(sel).Nodes); got != need {
+			t.Errorf("%s: get %d, need %d", sel, got, need)
+		}
+	}
+}
+
+func BenchmarkDeep(b *testing.B) {
+	for _, sel := range []string{"body div div div span", "html > div div div span", "section div div div span"} {
+		for _, depth := range []int{16, 64, 256} {
+			doc, s := nested(depth), MustCompile(sel)
+			b.Run(fmt.Sprintf("%s/%d", sel, depth), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					doc.Select(s)
+				}
+			})
+		}
+	}
+}
+
+func wide(n int) *Elements {
+	return Parse("<ul>" + strings.Repeat("<li></li>", n) + "</ul>")
+}
+
+func TestWide(t *testing.T) {
+	li := wide(20000).Find("li")
+	rev := &Elements{Nodes: make([]*node.Node, len(li.Nodes))}
+	for i, n := range li.Nodes {
+		rev.Nodes[len(li.Nodes)-1-i] = n
+	}
+	u := rev.Union(li)
+	if len(u.Nodes) != len(li.Nodes) || u.Nodes[0] != li.Nodes[0] || u.Nodes[len(u.Nodes)-1] != rev.Nodes[0] {
+		t.Errorf("Union: get %d nodes", len(u.Nodes))
+	}
+	if got := len(rev.Closest("li").Nodes); got != len(li.Nodes) {
+		t.Errorf("Closest: get %d", got)
+	}
+	if got := len(rev.Siblings("").Nodes); got != len(li.Nodes) {
+		t.Errorf("Siblings: get %d", got)
+	}
+	if got := len(li.Eq(5).Siblings("").Nodes); got != len(li.Nodes)-1 {
+		t.Errorf("Siblings: get %d", got)
+	}
+}
+
+func TestClassList(t *testing.T) {
+	doc := Parse("<p class=\"a  b\tc\nd a\"></p><p></p>")
+	p := doc.Find("p")
+	if got := p.Nodes[0].GetCls(); fmt.Sprint(got) != "[a b c d]" {
+		t.Errorf("Get %q", got)
+	}
+	if got := len(doc.Find(".b, .c, .d").Nodes); got != 1 {
+		t.Errorf("Get %d", got)
+	}
+
+	l := p.Nodes[0].ClassList()
+	if !l.Has("c") || l.Has("a b") || l.Has("") || l.Len() != 4 || l.Item(3) != "d" {
+		t.Errorf("Get %v", l)
+	}
+	l.Remove("b", "x")
+	l.Add("e", "a", "")
+	if !l.Replace("c", "a") || l.Replace("x", "y") || l.Toggle("d") || !l.Toggle("f") {
+		t.Errorf("Get %v", l)
+	}
+	if got := p.Nodes[0].GetAttr("class"); got != "a e f" {
+		t.Errorf("Get %q", got)
+	}
+
+	p.Nodes[1].ClassList().Remove("a")
+	if p.Nodes[1].HasAttr("class") {
+		t.Error("Remove added a class attribute")
+	}
+
+	doc = Parse(`<p class="x"></p><p></p>`).WithIndex()
+	doc.Find(".x")
+	p = doc.Find("p")
+	if p.AddClass("y  z").RemoveClass("x").ToggleClass("z w"); fmt.Sprint(p.Attrs("class")) != "[y w y w]" {
+		t.Errorf("Get %q", p.Attrs("class"))
+	}
+	if !p.HasClass("w") || p.HasClass("x") || len(p.Find("*").Nodes) != 0 {
+		t.Errorf("Get %q", p.Attrs("class"))
+	}
+	if got := len(doc.Find(".w").Nodes); got != 2 {
+		t.Errorf("Get %d", got)
+	}
+}
+
+func TestText(t *testing.T) {
+	doc := Parse(`<html><head><title>T</title><style>p {}</style></head><body>
+<div>  Hello,
+	<b>world</b>!<script>var x;</script><noscript>no</noscript></div><p>one<br>two<br><br>three</p>
+<ul><li>a</li><li> b <i>c</i></li></ul><table><tr><td>1</td><td>2</td></tr></table>
+<pre>  x
+  y</pre><template>tpl</template></body></html>`)
+	need := "Hello, world!\none\ntwo\n\nthree\na\nb c\n1 2\n  x\n  y"
+	if got := doc.TextWith(node.InnerText); got != need {
+		t.Errorf("Get %q, need %q", got, need)
+	}
+	if got := doc.Find("p").TextWith(node.TextOptions{Own: true, Blocks: true}); got != "one\ntwo\n\nthree" {
+		t.Errorf("Get %q", got)
+	}
+	if got := doc.Find("li").TextsWith(node.TextOptions{Own: true, Collapse: true}); fmt.Sprint(got) != "[a b]" {
+		t.Errorf("Get %q", got)
+	}
+	if got := doc.Find("title").TextWith(node.InnerText); got != "T" {
+		t.Errorf("Get %q", got)
+	}
+	if got := doc.Find("div").Text(); got != "  Hello,\n\tworld!var x;no" {
+		t.Errorf("Get %q", got)
+	}
+	var b strings.Builder
+	if err := doc.Find("li").WriteText(&b, node.TextOptions{Collapse: true}); err != nil || b.String() != "ab c" {
+		t.Errorf("Get %q, %v", b.String(), err)
+	}
+}
+
+func TestHtml(t *testing.T) {
+	doc := Parse(`<div id="a" title="x&quot;y"><p>one <b>two</b> <i>three</i></p>
+  <!-- c -->
+  <ul>
+    <li>1</li>   <li>2 &amp; 3</li>
+  </ul><br><script>if (a < b) {}</script><pre>
+ keep  this </pre></div><p>x</p>`)
+	div := doc.Find("#a")
+	if got := div.Find("p").Html(); got != "one <b>two</b> <i>three</i>" {
+		t.Errorf("Get %q", got)
+	}
+	if got := div.Find("li").OuterHtmls(); fmt.Sprint(got) != "[<li>1</li> <li>2 &amp; 3</li>]" {
+		t.Errorf("Get %q", got)
+	}
+	if got := doc.Find("p").Htmls(); len(got) != 2 || got[1] != "x" {
+		t.Errorf("Get %q", got)
+	}
+	if got := div.Find("script").Html(); got != "if (a < b) {}" {
+		t.Errorf("Get %q", got)
+	}
+	if got := div.OuterHtml(); !strings.HasPrefix(got, `<div id="a" title="x&#34;y"><p>`) || !strings.HasSuffix(got, "<pre> keep  this </pre></div>") {
+		t.Errorf("Get %q", got)
+	}
+
+	var b strings.Builder
+	if err := div.RenderWith(&b, node.RenderOptions{Minify: true}); err != nil {
+		t.Fatal(err)
+	}
+	need := `<div id="a" title="x&#34;y"><p>one <b>two</b> <i>three</i></p><ul><li>1</li><li>2 &amp; 3</li></ul><br/><script>if (a < b) {}</script><pre> keep  this </pre></div>`
+	if b.String() != need {
+		t.Errorf("Get %q, need %q", b.String(), need)
+	}
+
+	b.Reset()
+	if err := div.Find("ul").Union(doc.Find("p")).RenderWith(&b, node.RenderOptions{Indent: "  "}); err != nil {
+		t.Fatal(err)
+	}
+	need = "<p>\n  one\n  <b>two</b>\n  <i>three</i>\n</p>\n<ul>\n  <li>1</li>\n  <li>2 &amp; 3</li>\n</ul>\n<p>x</p>"
+	if b.String() != need {
+		t.Errorf("Get %q, need %q", b.String(), need)
+	}
+}
+
+func TestMutateError(t *testing.T) {
+	doc := Parse(`<div id="a"></div><div id="b"><div id="c"></div></div>`).WithIndex()
+	if len(doc.Find("#c").Nodes) != 1 {
+		t.Fatal("Find #c")
+	}
+	// The copy of #b goes into #a, then #b itself cannot go into #c.
+	err := doc.Find("#a, #c").Append(doc.Find("#b").Nodes[0]).Err
+	if err == nil || !strings.Contains(err.Error(), "cannot insert a node into itself") {
+		t.Errorf("Get %v", err)
+	}
+	if got := doc.Find("#c").Nodes; len(got) != 2 {
+		t.Errorf("Get %d nodes, the index is stale", len(got))
+	}
+	if got := doc.Find("#a #c").Nodes; len(got) != 1 {
+		t.Errorf("Get %d nodes", len(got))
+	}
+}
+
+func TestMutate(t *testing.T) {
+	doc := Parse(`<div id="a"><p class="x">1</p><p>2</p></div><div id="b"></div>`).WithIndex()
+	body := doc.Find("body")
+	inner := func() string { return body.Html() }
+
+	doc.Find("p").SetAttr("title", "t").RemoveAttr("class")
+	if got := inner(); got != `<div id="a"><p title="t">1</p><p title="t">2</p></div><div id="b"></div>` {
+		t.Errorf("Get %s", got)
+	}
+	doc.Find("#b").Append("<i>x</i>").Prepend(doc.Find("p").First())
+	if got := inner(); got != `<div id="a"><p title="t">2</p></div><div id="b"><p title="t">1</p><i>x</i></div>` {
+		t.Errorf("Get %s", got)
+	}
+	doc.Find("div").Before("<hr>").After(doc.Find("i"))
+	if got := inner(); got != `<hr/><div id="a"><p title="t">2</p></div><i>x</i><hr/><div id="b"><p title="t">1</p></div><i>x</i>` {
+		t.Errorf("Get %s", got)
+	}
+	doc.Find("hr").Remove()
+	doc.Find("i").ReplaceWith("<b>y</b>").Find("b")
+	doc.Find("#a").SetHtml("<em>e</em>")
+	doc.Find("#b p").SetText("<raw>")
+	if got := inner(); got != `<div id="a"><em>e</em></div><b>y</b><div id="b"><p title="t">&lt;raw&gt;</p></div><b>y</b>` {
+		t.Errorf("Get %s", got)
+	}
+	doc.Find("b").Wrap(`<section><span></span></section>`)
+	doc.Find("em").Unwrap()
+	if got := inner(); got != `<em>e</em><section><span><b>y</b></span></section><div id="b"><p title="t">&lt;raw&gt;</p></div><section><span><b>y</b></span></section>` {
+		t.Errorf("Get %s", got)
+	}
+	clone := doc.Find("#b").Clone()
+	doc.Find("#b").Empty()
+	if got := clone.Html(); got != `<p title="t">&lt;raw&gt;</p>` || clone.Nodes[0].Parent != nil {
+		t.Errorf("Get %s", got)
+	}
+	if got := len(doc.Find("#b p, i").Nodes) + len(doc.Find("span > b").Nodes); got != 2 {
+		t.Errorf("Get %d", got)
+	}
+	if err := doc.Find("section").Append(doc.Find("body")).Err; err == nil {
+		t.Error("Append into itself succeeded")
+	}
+	if err := doc.Find("section").Append(42).Err; err == nil {
+		t.Error("Append of an int succeeded")
+	}
+
+	doc = Parse(`<div><p>1</p><p>2</p></div><span></span>`)
+	body = doc.Find("body")
+	div := doc.Find("div")
+	twice := &Elements{Nodes: append(div.Nodes, div.Nodes...)}
+	twice.Wrap("<section>")
+	doc.Find("html, body").Wrap("<main>")
+	if got := inner(); got != `<section><div><p>1</p><p>2</p></div></section><span></span>` {
+		t.Errorf("Get %s", got)
+	}
+	twice.ReplaceWith("<hr>")
+	if got := inner(); got != `<section><hr/></section><span></span>` {
+		t.Errorf("Get %s", got)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	doc := Parse(`<div id="a" class="x"><p id="p1"><b id="b1"></b></p><section><p id="p2" class="x"></p></section></div><p id="p3"><i id="i1"></i></p>`)
+	p := doc.Find("p")
+	for sel, need := range map[string]string{
+		"div > p":   "[p1]",
+		"div p, .x": "[p1 p2]",
+		"body > *":  "[p3]",
+	} {
+		if got := p.Filter(sel).Attrs("id"); fmt.Sprint(got) != need {
+			t.Errorf("%s: get %v, need %s", sel, got, need)
+		}
+	}
+	if !p.Is("section > .x") || p.Is("div > section") || p.Is("p >") {
+		t.Error("Is")
+	}
+	if got := p.Has("b, i").Attrs("id"); fmt.Sprint(got) != "[p1 p3]" {
+		t.Errorf("Get %v", got)
+	}
+	if got := doc.Find("b, p").Closest("p, section").Attrs("id"); fmt.Sprint(got) != "[p1 p2 p3]" {
+		t.Errorf("Get %v", got)
+	}
+	if got := doc.Find("b, p").Closest("div.x").Attrs("id"); fmt.Sprint(got) != "[a]" {
+		t.Errorf("Get %v", got)
+	}
+	even := func(i int, el *Elements) bool { return i%2 == 0 }
+	if got := p.FilterFunc(even).Attrs("id"); fmt.Sprint(got) != "[p1 p3]" {
+		t.Errorf("Get %v", got)
+	}
+	if got := p.NotFunc(even).Attrs("id"); fmt.Sprint(got) != "[p2]" {
+		t.Errorf("Get %v", got)
+	}
+	if err := p.Filter("[").Err; err == nil || p.Err != nil {
+		t.Errorf("Get %v, %v", err, p.Err)
+	}
+}
+
+func TestTraverse(t *testing.T) {
+	doc := Parse(`<div id="d"><section id="s1"><article id="a"><p id="p1"></p><i id="i1"></i><b id="b1"></b><b id="b2"></b></article></section></div><section id="s2"><p id="p2"></p></section>`)
+	p, i := doc.Find("p"), doc.Find("i")
+	flat := Parse(`<div id="d"><p id="p1">a<!--c--></p><i id="i1"></i><p id="p2"></p><b id="b1"></b><p id="p3"></p></div>`)
+	fp := flat.Find("p")
+	twice := &Elements{Nodes: append(flat.Find("#p2").Nodes, flat.Find("#p2").Nodes...)}
+	for _, c := range []struct {
+		name string
+		got  *Elements
+		need string
+	}{
+		{"Parents(div > section)", p.Parents("div > section"), "[s1]"},
+		{"Parents()", doc.Find("#p1").Parents(""), "[a s1 d  ]"},
+		{"Parent(body > *)", p.Parent("body > *"), "[s2]"},
+		{"Child(section > *)", doc.Find("section").Child("section > *"), "[a p2]"},
+		{"Child(div article, p)", doc.Find("article, section").Child("div article, p"), "[a p1 p2]"},
+		{"Next(p + i)", p.Next("p + i"), "[i1]"},
+		{"NextAll(i ~ b)", i.NextAll("i ~ b"), "[b1 b2]"},
+		{"NextAll(b + b)", i.NextAll("b + b"), "[b2]"},
+		{"Prev(section p)", i.Prev("section p"), "[p1]"},
+		{"PrevAll(article > *)", doc.Find("#b2").PrevAll("article > *"), "[b1 i1 p1]"},
+		{"Not(p, i + b)", doc.Find("article").Child("").Not("p, i + b"), "[i1 b2]"},
+
+		{"Not", fp.Not("#p2, div > i + p + b + p"), "[p1]"},
+		{"Siblings", fp.Siblings(""), "[p1 i1 p2 b1 p3]"},
+		{"Siblings(p)", fp.Siblings("p"), "[p1 p2 p3]"},
+		{"Siblings of one", flat.Find("#p2").Siblings(""), "[p1 i1 b1 p3]"},
+		{"Siblings of a duplicate", twice.Siblings(""), "[p1 i1 b1 p3]"},
+		{"Children", flat.Find("div").Children("i ~ *"), "[p2 b1 p3]"},
+		{"ParentsUntil", flat.Find("#p1").ParentsUntil("body", ""), "[d]"},
+		{"ParentsUntil()", flat.Find("#p1").ParentsUntil("", "div, body"), "[d ]"},
+		{"NextUntil", flat.Find("#p1").NextUntil("b", ""), "[i1 p2]"},
+		{"NextUntil(p)", flat.Find("#p1").NextUntil("", "p"), "[p2 p3]"},
+		{"PrevUntil", flat.Find("#p3").PrevUntil("i", ""), "[b1 p2]"},
+		{"PrevUntil(i ~ p)", flat.Find("#p3").PrevUntil("#p1", "i ~ p"), "[p2]"},
+		{"PrevUntil(, i ~ p)", flat.Find("#p3").PrevUntil("", "i ~ p"), "[p2]"},
+		{"Parent from siblings", fp.Parent(""), "[d]"},
+		{"Parents from siblings", fp.Parents(""), "[d  ]"},
+		{"Next from siblings", fp.Next(""), "[i1 b1]"},
+		{"Prev from siblings", fp.Prev(""), "[i1 b1]"},
+		{"NextAll from siblings", fp.NextAll(""), "[i1 p2 b1 p3]"},
+		{"PrevAll from siblings", fp.PrevAll(""), "[b1 p2 i1 p1]"},
+		{"ParentsUntil from siblings", fp.ParentsUntil("html", ""), "[d ]"},
+	} {
+		if c.got.Err != nil || fmt.Sprint(c.got.Attrs("id")) != c.need {
+			t.Errorf("%s: get %v, %v, need %s", c.name, c.got.Attrs("id"), c.got.Err, c.need)
+		}
+	}
+
+	if err := p.Parents("div >").Err; err == nil || p.Err != nil {
+		t.Errorf("Get %v, %v", err, p.Err)
+	}
+	if got := flat.Find("#p1").Contents().Nodes; len(got) != 2 || got[0].Data != "a" || got[1].Data != "c" {
+		t.Errorf("Get %v", got)
+	}
+	if err := fp.NextUntil("[", "").Err; err == nil {
+		t.Error("Get no error")
+	}
+	if err := fp.Not("").Err; !errors.Is(err, ErrSyntax) {
+		t.Errorf("Get %v", err)
+	}
+}
+
+func TestFunctional(t *testing.T) {
+	doc := Parse(`<ul><li class="b">3</li><li class="a">1</li><li class="b">2</li><li class="a">4</li></ul>`)
+	li := doc.Find("li")
+	if got := Map(li, func(i int, el *Elements) string { return fmt.Sprint(i, el.Text()) }); fmt.Sprint(got) != "[03 11 22 34]" {
+		t.Errorf("Get %v", got)
+	}
+	sum := Reduce(li, 0, func(acc, i int, el *Elements) int {
+		var n int
+		fmt.Sscan(el.Text(), &n)
+		return acc + n
+	})
+	if sum != 10 {
+		t.Errorf("Get %d", sum)
+	}
+	groups := GroupBy(li, func(i int, el *Elements) string { return el.Attr("class") })
+	if len(groups) != 2 || fmt.Sprint(groups["a"].Texts()) != "[1 4]" || fmt.Sprint(groups["b"].Texts()) != "[3 2]" {
+		t.Errorf("Get %v", groups)
+	}
+	sorted := SortBy(li, func(el *Elements) string { return el.Attr("class") })
+	if fmt.Sprint(sorted.Texts()) != "[1 4 3 2]" || sorted.End() != li {
+		t.Errorf("Get %v", sorted.Texts())
+	}
+
+	seen := []int{}
+	if li.Each(func(i int, el *Elements) bool { seen = append(seen, i); return i < 1 }) != li || fmt.Sprint(seen) != "[0 1]" {
+		t.Errorf("Get %v", seen)
+	}
+	for i, need := range map[int]string{0: "[3]", -1: "[4]", -4: "[3]", 4: "[]", -5: "[]"} {
+		if got := li.Eq(i).Texts(); fmt.Sprint(got) != need {
+			t.Errorf("Eq(%d): get %v, need %s", i, got, need)
+		}
+	}
+	for r, need := range map[[2]int]string{{1, 3}: "[1 2]", {-2, 4}: "[2 4]", {2, 1}: "[]", {-9, 9}: "[3 1 2 4]"} {
+		if got := li.Slice(r[0], r[1]).Texts(); fmt.Sprint(got) != need {
+			t.Errorf("Slice%v: get %v, need %s", r, got, need)
+		}
+	}
+	if li.Len() != 4 || li.Filter(".a").End() != li || li.End().End().Len() != 0 {
+		t.Error("Len or End")
+	}
+	if li.Filter(".a").Eq(0).End().End() != li {
+		t.Error("End")
+	}
+}
+
+func TestIter(t *testing.T) {
+	doc := Parse(`<div id="a"><p id="b">x<i id="c"></i></p><p id="d"></p></div><p id="e"></p>`)
+	ids := func(seq func(yield func(*node.Node) bool), limit int) []string {
+		out := []string{}
+		for n := range seq {
+			if len(out) == limit {
+				break
+			}
+			out = append(out, n.Data+n.GetAttr("id"))
+		}
+		return out
+	}
+	a := doc.Find("#a").Nodes[0]
+	if got := ids(a.Descendants(), -1); fmt.Sprint(got) != "[pb x ic pd]" {
+		t.Errorf("Get %v", got)
+	}
+	if got := ids(a.Descendants(), 2); fmt.Sprint(got) != "[pb x]" {
+		t.Errorf("Get %v", got)
+	}
+	if got := ids(doc.Find("#c").Nodes[0].Ancestors(), 3); fmt.Sprint(got) != "[pb diva body]" {
+		t.Errorf("Get %v", got)
+	}
+	if got := ids(doc.Find("#b").Nodes[0].FollowingSiblings(), -1); fmt.Sprint(got) != "[pd]" {
+		t.Errorf("Get %v", got)
+	}
+
+	got := []string{}
+	for i, el := range doc.Find("p").All() {
+		if i == 2 {
+			break
+		}
+		got = append(got, el.Attr("id"))
+	}
+	if fmt.Sprint(got) != "[b d]" {
+		t.Errorf("Get %v", got)
+	}
+	if got := ids(doc.Find("p").NodeSeq(), -1); fmt.Sprint(got) != "[pb pd pe]" {
+		t.Errorf("Get %v", got)
+	}
+	for range doc.Find("[").NodeSeq() {
+		t.Error("Yielded from an error")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	doc := Parse(`<div id="post"><p title="">x</p></div>`)
+	links := doc.Find("#post a")
+	first := links.First()
+	if first.Err == nil || first.Err.Error() != `Find("#post a") → First(): empty set` || !errors.Is(first.Err, ErrEmpty) {
+		t.Errorf("Get %v", first.Err)
+	}
+	var chain *ChainError
+	if !errors.As(first.Err, &chain) || len(chain.Ops) != 2 {
+		t.Errorf("Get %#v", chain)
+	}
+	if links.Err != nil || doc.Err != nil || first.Text() != "" {
+		t.Error("Receiver changed")
+	}
+	if err := first.Find("p").Last().Err; err != first.Err {
+		t.Errorf("Get %v", err)
+	}
+
+	p := doc.Find("p")
+	for i, err := range []error{p.Get(1).Err, p.Get(-1).Err, links.Last().Err} {
+		if need := []error{ErrOutOfRange, ErrOutOfRange, ErrEmpty}[i]; !errors.Is(err, need) {
+			t.Errorf("%d: get %v, need %v", i, err, need)
+		}
+	}
+	if err := doc.Find("div").Filter("p >").Err; !errors.Is(err, ErrSyntax) || !strings.HasPrefix(err.Error(), `Find("div") → Filter("p >"): invalid selector: `) {
+		t.Errorf("Get %v", err)
+	}
+	if err := doc.Find("[").Err; !errors.Is(err, ErrSyntax) {
+		t.Errorf("Get %v", err)
+	}
+	if _, err := CompileWithOptions(strings.Repeat("a, ", 300)+"a", parser.DefaultParserOptions); errors.Is(err, ErrSyntax) || !errors.Is(err, parser.ErrLimitExceeded) {
+		t.Errorf("Get %v", err)
+	}
+	if err := doc.XPath("//p[").Err; !errors.Is(err, ErrSyntax) {
+		t.Errorf("Get %v", err)
+	}
+
+	if s, err := p.TextE(); s != "x" || err != nil {
+		t.Errorf("Get %q, %v", s, err)
+	}
+	if _, err := links.TextE(); !errors.Is(err, ErrEmpty) || err.Error() != `Find("#post a") → Text(): empty set` {
+		t.Errorf("Get %v", err)
+	}
+	if s, err := p.AttrE("title"); s != "" || err != nil {
+		t.Errorf("Get %q, %v", s, err)
+	}
+	if _, err := p.AttrE("id"); !errors.Is(err, ErrNoAttr) {
+		t.Errorf("Get %v", err)
+	}
+	if _, err := first.AttrE("id"); err != first.Err {
+		t.Errorf("Get %v", err)
+	}
+
+	if Must(p.TextE()) != "x" || p.Must() != p {
+		t.Error("Must")
+	}
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrEmpty) {
+			t.Errorf("Get %v", err)
+		}
+	}()
+	first.Must()
+}
+
+func TestAttrs(t *testing.T) {
+	doc := Parse(`<input id="i" disabled value="" data-product-id="42" data-name="shoe" data-tags='["a","b"]' data-x-1="y" data-price="1.5" data-bad="{">`)
+	in := doc.Find("input")
+	if v, ok := in.AttrOk("value"); v != "" || !ok {
+		t.Errorf("Get %q, %v", v, ok)
+	}
+	if v, ok := in.AttrOk("title"); v != "" || ok {
+		t.Errorf("Get %q, %v", v, ok)
+	}
+	if in.AttrOr("title", "def") != "def" || in.AttrOr("id", "def") != "i" || doc.Find("p").AttrOr("id", "def") != "def" {
+		t.Error("AttrOr")
+	}
+	if !in.BoolAttr("disabled") || in.BoolAttr("checked") {
+		t.Error("BoolAttr")
+	}
+	in.SetBoolAttr("disabled", false).SetBoolAttr("checked", true)
+	if in.BoolAttr("disabled") || !in.BoolAttr("checked") || in.Attr("checked") != "" {
+		t.Error("SetBoolAttr")
+	}
+
+	if v, ok := in.Data("productId"); v != "42" || !ok {
+		t.Errorf("Get %q, %v", v, ok)
+	}
+	if _, ok := in.Data("product-id"); ok {
+		t.Error("Data(product-id)")
+	}
+	if got := fmt.Sprint(in.Dataset()); got != `map[bad:{ name:shoe price:1.5 productId:42 tags:["a","b"] x-1:y]` {
+		t.Errorf("Get %s", got)
+	}
+	var tags []string
+	if err := in.DataJSON("tags", &tags); err != nil || fmt.Sprint(tags) != "[a b]" {
+		t.Errorf("Get %v, %v", tags, err)
+	}
+	if err := in.DataJSON("missing", &tags); !errors.Is(err, ErrNoAttr) {
+		t.Errorf("Get %v", err)
+	}
+	var product struct {
+		ID    int      `json:"productId"`
+		Name  string   `json:"name"`
+		Price float64  `json:"price"`
+		Tags  []string `json:"tags"`
+		Bad   string   `json:"bad"`
+	}
+	if err := in.DecodeData(&product); err != nil || fmt.Sprint(product) != "{42 shoe 1.5 [a b] {}" {
+		t.Errorf("Get %v, %v", product, err)
+	}
+
+	var strs struct {
+		Name  string  `json:"name"`
+		Flag  string  `json:"flag"`
+		Title *string `json:"title"`
+		On    bool    `json:"flag2"`
+	}
+	el := Parse(`<p data-name="123" data-flag="true" data-title='"q"' data-flag2="true">`).Find("p")
+	if err := el.DecodeData(&strs); err != nil || strs.Name != "123" || strs.Flag != "true" || strs.Title == nil || *strs.Title != `"q"` || !strs.On {
+		t.Errorf("Get %+v, %v", strs, err)
+	}
+	var m map[string]string
+	if err := el.DecodeData(&m); err != nil || m["title"] != `"q"` || m["name"] != "123" {
+		t.Errorf("Get %v, %v", m, err)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	doc := Parse(`<div id="p">
+		<h1 class="title"> Shoe </h1>
+		<a class="link" href="/shoe?id=1">buy</a>
+		<span class="price">19.5</span><span class="stock">3</span>
+		<input type="checkbox" data-sale="true">
+		<time datetime="2024-03-01">March</time>
+		<ul class="tags"><li>red</li><li>blue</li></ul>
+		<div class="seller"><b class="name">Bob</b></div>
+		<div class="review"><b>5</b><a href="/r/1">one</a></div>
+		<div class="review"><b>3</b></div>
+	</div>`)
+	type review struct {
+		Stars int     `css:"b"`
+		Link  url.URL `css:"a" attr:"href"`
+	}
+	var p struct {
+		Name    string    `css:"h1.title" required:"true"`
+		Link    *url.URL  `css:"a.link" attr:"href"`
+		Price   float64   `css:".price"`
+		Stock   uint8     `css:".stock"`
+		Sale    bool      `css:"input" attr:"data-sale"`
+		Added   time.Time `css:"time" attr:"datetime" layout:"2006-01-02"`
+		Tags    []string  `css:"ul.tags li"`
+		Kept    []string  `css:".missing li"`
+		Missing string    `css:".missing"`
+		NoAttr  *string   `css:"h1" attr:"title"`
+		Seller  struct {
+			Name string `css:".name"`
+			ID   string `css:"" attr:"class"`
+		} `css:".seller"`
+		Reviews []*review `css:".review"`
+		Skipped string
+	}
+	p.Missing = "def"
+	p.Kept = []string{"kept"}
+	if err := Unmarshal(doc, &p); err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprintln(p.Name, p.Link, p.Price, p.Stock, p.Sale, p.Added.Format("Jan 2"), p.Tags, p.Missing, p.NoAttr, p.Seller, len(p.Reviews))
+	if got != "Shoe /shoe?id=1 19.5 3 true Mar 1 [red blue] def <nil> {Bob seller} 2\n" {
+		t.Errorf("Get %s", got)
+	}
+	if fmt.Sprint(p.Kept) != "[kept]" {
+		t.Errorf("Get %v", p.Kept)
+	}
+	if p.Reviews[0].Stars != 5 || p.Reviews[0].Link.Path != "/r/1" || p.Reviews[1].Stars != 3 || p.Reviews[1].Link.Path != "" {
+		t.Errorf("Get %+v %+v", p.Reviews[0], p.Reviews[1])
+	}
+
+	var missing struct {
+		Author string `css:".author" required:"true"`
+	}
+	err := Unmarshal(doc, &missing)
+	var ue *UnmarshalError
+	if !errors.As(err, &ue) || ue.Field != "Author" || ue.Selector != ".author" || !errors.Is(err, ErrEmpty) {
+		t.Errorf("Get %v", err)
+	}
+
+	type bad struct {
+		Stars int `css:"a"`
+	}
+	var nested struct {
+		Reviews []bad `css:".review"`
+	}
+	err = Unmarshal(doc, &nested)
+	if !errors.As(err, &ue) || ue.Field != "Reviews[0].Stars" || ue.Selector != "a" {
+		t.Errorf("Get %v", err)
+	}
+	if err.Error() != `selector: Reviews[0].Stars (css "a"): strconv.ParseInt: parsing "one": invalid syntax` {
+		t.Errorf("Get %v", err)
+	}
+
+	var attr struct {
+		Href string `css:"h1" attr:"href" required:"true"`
+	}
+	if err := Unmarshal(doc, &attr); !errors.Is(err, ErrNoAttr) {
+		t.Errorf("Get %v", err)
+	}
+	var syntax struct {
+		X string `css:"div >"`
+	}
+	if err := Unmarshal(doc, &syntax); !errors.Is(err, ErrSyntax) {
+		t.Errorf("Get %v", err)
+	}
+	if err := Unmarshal(doc, p); err == nil {
+		t.Error("Unmarshal into a struct value")
+	}
+	if err := Unmarshal(doc.Find("p").First(), &p); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Get %v", err)
+	}
+
+	var deep struct {
+		Name   **string   `css:"h1.title"`
+		Stock  ***int     `css:".stock"`
+		NoAttr **string   `css:"h1" attr:"title"`
+		Tags   []**string `css:"ul.tags li"`
+		Seller **struct {
+			Name *string `css:".name"`
+		} `css:".seller"`
+	}
+	if err := Unmarshal(doc, &deep); err != nil {
+		t.Fatal(err)
+	}
+	if **deep.Name != "Shoe" || ***deep.Stock != 3 || deep.NoAttr != nil || len(deep.Tags) != 2 || **deep.Tags[1] != "blue" || *(*deep.Seller).Name != "Bob" {
+		t.Errorf("Get %+v", deep)
+	}
+
+	for _, v := range []interface{}{
+		&struct {
+			M map[string]string `css:".none"`
+		}{},
+		&struct {
+			C *chan int `css:".none"`
+		}{},
+		&struct {
+			S []struct {
+				I interface{} `css:".none"`
+			} `css:".none"`
+		}{},
+		&struct {
+			L [][]string `css:".none"`
+		}{},
+	} {
+		if err := Unmarshal(doc, v); !errors.As(err, &ue) || !strings.Contains(err.Error(), "unsupported field type") {
+			t.Errorf("%T: get %v", v, err)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{"fields": [
+		{"name": "title", "selector": "h1", "required": true},
+		{"name": "link", "selector": "a.buy", "type": "attr", "attr": "href"},
+		{"name": "body", "selector": ".body", "type": "html"},
+		{"name": "tags", "selector": ".tags li", "type": "list"},
+		{"name": "links", "selector": ".tags a", "type": "list", "item": {"type": "attr", "attr": "href"}},
+		{"name": "reviews", "selector": ".review", "type": "list", "item": {"type": "object", "fields": [
+			{"name": "stars", "selector": ".stars", "required": true},
+			{"name": "by", "selector": "a", "type": "attr", "attr": "title", "default": "anonymous"}
+		]}},
+		{"name": "seller", "selector": ".seller", "type": "object", "fields": [{"name": "name", "selector": ".name"}]},
+		{"name": "price", "selector": ".price", "default": 0},
+		{"name": "sku", "selector": ".sku"},
+		{"name": "isbn", "selector": ".isbn", "required": true, "default": null},
+		{"name": "author", "selector": ".author", "required": true}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := Parse(`<h1> Shoe </h1><a class="buy" href="/buy">Buy</a><div class="body"><b>Nice</b> shoe</div>
+		<ul class="tags"><li>red</li><li><a href="/blue">blue</a></li></ul>
+		<div class="review"><span class="stars">5</span><a title="ann">x</a></div>
+		<div class="review"><a>y</a></div>
+		<div class="seller"><span class="name">Bob</span></div>`)
+	out, report := Extract(doc, schema)
+	b, _ := json.Marshal(out)
+	want := `{"author":null,"body":"\u003cb\u003eNice\u003c/b\u003e shoe","isbn":null,"link":"/buy","links":["/blue"],"price":0,` +
+		`"reviews":[{"by":"ann","stars":"5"},{"by":"anonymous","stars":null}],"seller":{"name":"Bob"},"sku":null,"tags":["red","blue"],"title":"Shoe"}`
+	if string(b) != want {
+		t.Errorf("Get %s", b)
+	}
+	if report.Valid() || len(report.Errors) != 2 || fmt.Sprint(report.Defaulted) != "[reviews[1].by price isbn]" {
+		t.Errorf("Get %v %v", report.Errors, report.Defaulted)
+	}
+	var ue *UnmarshalError
+	if !errors.As(report.Errors[0], &ue) || ue.Field != "reviews[1].stars" || ue.Selector != ".stars" || !errors.Is(ue, ErrEmpty) {
+		t.Errorf("Get %v", report.Errors[0])
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), `author (css ".author")`) {
+		t.Errorf("Get %v", err)
+	}
+
+	out, report = Extract(Parse(`<h1>T</h1><p class="author">A</p>`), schema)
+	if !report.Valid() || fmt.Sprint(out["tags"], out["seller"]) != "[] <nil>" {
+		t.Errorf("Get %v %v", out, report.Errors)
+	}
+	if _, ok := out["price"].(float64); !ok {
+		t.Errorf("Get %T", out["price"])
+	}
+
+	for _, s := range []*Schema{
+		nil,
+		{Fields: []*Field{{Name: "a", Selector: "div >"}}},
+		{Fields: []*Field{{Name: "a", Default: json.RawMessage("{")}}},
+	} {
+		if out, report := Extract(doc, s); report.Valid() || len(out) != 0 {
+			t.Errorf("Get %v %v", out, report.Errors)
+		}
+	}
+
+	for _, s := range []string{
+		`{"fields": [{"selector": "h1"}]}`,
+		`{"fields": [{"name": "a"}, {"name": "a"}]}`,
+		`{"fields": [{"name": "a", "type": "attr"}]}`,
+		`{"fields": [{"name": "a", "type": "object"}]}`,
+		`{"fields": [{"name": "a", "type": "number"}]}`,
+		`{"fields": [{"name": "a", "selector": "div >"}]}`,
+		`{"fields": [{"name": "a", "type": "list", "item": {"type": "attr"}}]}`,
+		`{"fields": [{"name": "a", "sel": "div"}]}`,
+	} {
+		if _, err := ParseSchema([]byte(s)); err == nil {
+			t.Errorf("ParseSchema(%s) should fail", s)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package selector
+
+import (
+	"github.com/SteveZhangBit/leiogo-css/node"
+	"golang.org/x/net/html"
+)
+
+// Union returns the nodes in e or other, in document order and without
+// duplicates.
+func (e *Elements) Union(other *Elements) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	if other.Err != nil {
+		return other
+	}
+	nodes := append(append([]*node.Node{}, e.Nodes...), other.Nodes...)
+	return e.derive(call("Union"), node.SortUnique(nodes))
+}
+
+// Add is an alias of Union.
+func (e *Elements) Add(other *Elements) *Elements {
+	return e.Union(other)
+}
+
+// Intersect returns the nodes in both e and other, in document order.
+func (e *Elements) Intersect(other *Elements) *Elements {
+	return e.setHelper(call("Intersect"), other, true)
+}
+
+// Difference returns the nodes in e but not in other, in document order.
+func (e *Elements) Difference(other *Elements) *Elements {
+	return e.setHelper(call("Difference"), other, false)
+}
+
+func (e *Elements) setHelper(op operation, other *Elements, in bool) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	if other.Err != nil {
+		return other
+	}
+	set := other.set()
+	nodes := []*node.Node{}
+	for _, n := range e.Nodes {
+		if set[n.Identity()] == in {
+			nodes = append(nodes, n)
+		}
+	}
+	return e.derive(op, node.SortUnique(nodes))
+}
+
+// Contains reports whether every node of other is also in e.
+func (e *Elements) Contains(other *Elements) bool {
+	if e.Err != nil || other.Err != nil {
+		return false
+	}
+	set := e.set()
+	for _, n := range other.Nodes {
+		if !set[n.Identity()] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSame reports whether e and other hold the same nodes, ignoring order
+// and duplicates.
+func (e *Elements) IsSame(other *Elements) bool {
+	return e.Contains(other) && other.Contains(e)
+}
+
+// Index returns the position of the first node among its element siblings,
+// or -1 if e is empty.
+func (e *Elements) Index() int {
+	if e.Err != nil || len(e.Nodes) == 0 {
+		return -1
+	}
+	i := 0
+	for s := e.Nodes[0].PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			i++
+		}
+	}
+	return i
+}
+
+// IndexOf returns the position of the first node of other in e, or -1.
+func (e *Elements) IndexOf(other *Elements) int {
+	if e.Err != nil || other.Err != nil || len(other.Nodes) == 0 {
+		return -1
+	}
+	for i, n := range e.Nodes {
+		if n.Identity() == other.Nodes[0].Identity() {
+			return i
+		}
+	}
+	return -1
+}
+
+// Sort returns the nodes of e in document order without duplicates.
+func (e *Elements) Sort() *Elements {
+	if e.Err != nil {
+		return e
+	}
+	return e.derive(call("Sort"), node.SortUnique(append([]*node.Node{}, e.Nodes...)))
+}
+
+// set holds the nodes of e by identity, so that attribute nodes from
+// different XPath calls count as the same node.
+func (e *Elements) set() map[node.Identity]bool {
+	set := make(map[node.Identity]bool, len(e.Nodes))
+	for _, n := range e.Nodes {
+		set[n.Identity()] = true
+	}
+	return set
+}
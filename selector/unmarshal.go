@@ -0,0 +1,284 @@
+package selector
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnmarshalError reports a field that Unmarshal could not fill.
+type UnmarshalError struct {
+	// Field is the path to the field, such as "Post.Comments[2].Author".
+	Field    string
+	Selector string
+	Err      error
+}
+
+func (e *UnmarshalError) Error() string {
+	return fmt.Sprintf("selector: %s (css %q): %v", e.Field, e.Selector, e.Err)
+}
+
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	urlType  = reflect.TypeOf(url.URL{})
+	textType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Unmarshal fills the struct v points to from el. Only fields with a css
+// tag are set; the tag is a selector run with Find on el, and an empty tag
+// means el itself:
+//
+//	type Product struct {
+//		Name   string    `css:"h1.title"`
+//		Link   *url.URL  `css:"a.link" attr:"href"`
+//		Price  float64   `css:".price" required:"true"`
+//		Tags   []string  `css:"ul.tags li"`
+//		Added  time.Time `css:"time" attr:"datetime" layout:"2006-01-02"`
+//		Seller struct {
+//			Name string `css:".name"`
+//		} `css:".seller"`
+//	}
+//
+// A field takes the first match, and a slice every match. The value is the
+// trimmed text of the match, or the attribute named by the attr tag. It is
+// converted to the field's type: strings, integers, floats, bools,
+// time.Time (with the layout tag, RFC 3339 by default), url.URL and any
+// encoding.TextUnmarshaler. Struct fields are filled from their match in
+// turn, so their selectors are scoped to it, and pointers, at any depth,
+// are allocated when there is a match. Fields of any other type, such as
+// maps, channels and interfaces, are rejected before any selector runs.
+//
+// Fields are optional: with no match, or no attribute, the field keeps its
+// value. A required:"true" tag turns that into an error wrapping ErrEmpty
+// or ErrNoAttr. Every error is an *UnmarshalError naming the field and its
+// selector.
+func Unmarshal(el *Elements, v interface{}) error {
+	if el.Err != nil {
+		return el.Err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("selector: Unmarshal needs a non-nil pointer to a struct, not %T", v)
+	}
+	return unmarshalStruct(el, rv.Elem(), rv.Elem().Type().Name())
+}
+
+func unmarshalStruct(el *Elements, rv reflect.Value, path string) error {
+	rt := rv.Type()
+	if err := checkFields(rt, path, map[reflect.Type]bool{}); err != nil {
+		return err
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		sel, ok := f.Tag.Lookup("css")
+		if !ok || f.PkgPath != "" {
+			continue
+		}
+		fu := &fieldUnmarshaler{
+			path:     join(path, f.Name),
+			sel:      sel,
+			attr:     f.Tag.Get("attr"),
+			layout:   f.Tag.Get("layout"),
+			required: f.Tag.Get("required") == "true",
+		}
+		if err := fu.field(el, rv.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFields rejects the css fields of rt, and of the structs they hold,
+// whose type Unmarshal cannot fill.
+func checkFields(rt reflect.Type, path string, seen map[reflect.Type]bool) error {
+	seen[rt] = true
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		sel, ok := f.Tag.Lookup("css")
+		if !ok || f.PkgPath != "" {
+			continue
+		}
+		t := f.Type
+		if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+			t = t.Elem()
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch {
+		case isScalar(t):
+		case t.Kind() == reflect.Struct:
+			if !seen[t] {
+				if err := checkFields(t, join(path, f.Name), seen); err != nil {
+					return err
+				}
+			}
+		case !isBasic(t):
+			err := fmt.Errorf("unsupported field type %s", f.Type)
+			return &UnmarshalError{Field: join(path, f.Name), Selector: sel, Err: err}
+		}
+	}
+	return nil
+}
+
+// isBasic reports whether t is one of the kinds convert parses itself.
+func isBasic(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+type fieldUnmarshaler struct {
+	path, sel, attr, layout string
+	required                bool
+}
+
+func (fu *fieldUnmarshaler) fail(err error) error {
+	var ue *UnmarshalError
+	if errors.As(err, &ue) {
+		return err
+	}
+	return &UnmarshalError{Field: fu.path, Selector: fu.sel, Err: err}
+}
+
+func (fu *fieldUnmarshaler) field(el *Elements, fv reflect.Value) error {
+	matches := el
+	if strings.TrimSpace(fu.sel) != "" {
+		matches = el.Find(fu.sel)
+	}
+	if matches.Err != nil {
+		return fu.fail(matches.Err)
+	}
+
+	if len(matches.Nodes) == 0 {
+		if fu.required {
+			return fu.fail(ErrEmpty)
+		}
+		return nil
+	}
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(fv.Type(), 0, len(matches.Nodes))
+		path := fu.path
+		for i, item := range matches.Iterator() {
+			ev := reflect.New(fv.Type().Elem()).Elem()
+			fu.path = fmt.Sprintf("%s[%d]", path, i)
+			if ok, err := fu.value(item, ev); err != nil {
+				return err
+			} else if ok {
+				slice = reflect.Append(slice, ev)
+			}
+		}
+		fu.path = path
+		fv.Set(slice)
+		return nil
+	}
+	if _, err := fu.value(matches.First(), fv); err != nil {
+		return err
+	}
+	return nil
+}
+
+// value fills fv from the single node el, and reports whether there was
+// a value to fill it with.
+func (fu *fieldUnmarshaler) value(el *Elements, fv reflect.Value) (bool, error) {
+	if fv.Kind() == reflect.Ptr {
+		p := reflect.New(fv.Type().Elem())
+		ok, err := fu.value(el, p.Elem())
+		if ok && err == nil {
+			fv.Set(p)
+		}
+		return ok, err
+	}
+	if fv.Kind() == reflect.Struct && !isScalar(fv.Type()) {
+		return true, unmarshalStruct(el, fv, fu.path)
+	}
+
+	s, ok := el.AttrOk(fu.attr)
+	if fu.attr == "" {
+		s, ok = strings.TrimSpace(el.Text()), true
+	}
+	if !ok {
+		if fu.required {
+			return false, fu.fail(fmt.Errorf("%w %q", ErrNoAttr, fu.attr))
+		}
+		return false, nil
+	}
+	return true, fu.convert(s, fv)
+}
+
+// isScalar reports whether the struct or named type t is filled from a
+// single string rather than field by field.
+func isScalar(t reflect.Type) bool {
+	return t == timeType || t == urlType || reflect.PointerTo(t).Implements(textType)
+}
+
+func (fu *fieldUnmarshaler) convert(s string, fv reflect.Value) error {
+	var err error
+	switch {
+	case fv.Type() == timeType:
+		layout := fu.layout
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			fv.Set(reflect.ValueOf(t))
+		}
+	case fv.Type() == urlType:
+		var u *url.URL
+		if u, err = url.Parse(s); err == nil {
+			fv.Set(reflect.ValueOf(*u))
+		}
+	case reflect.PointerTo(fv.Type()).Implements(textType):
+		err = fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	default:
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(s)
+		case reflect.Bool:
+			var b bool
+			if b, err = strconv.ParseBool(s); err == nil {
+				fv.SetBool(b)
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			var n int64
+			if n, err = strconv.ParseInt(s, 10, fv.Type().Bits()); err == nil {
+				fv.SetInt(n)
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			var n uint64
+			if n, err = strconv.ParseUint(s, 10, fv.Type().Bits()); err == nil {
+				fv.SetUint(n)
+			}
+		case reflect.Float32, reflect.Float64:
+			var n float64
+			if n, err = strconv.ParseFloat(s, fv.Type().Bits()); err == nil {
+				fv.SetFloat(n)
+			}
+		case reflect.Slice:
+			fv.SetBytes([]byte(s))
+		default:
+			err = fmt.Errorf("unsupported field type %s", fv.Type())
+		}
+	}
+	if err != nil {
+		return fu.fail(err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package selector
+
+import (
+	"fmt"
+
+	"github.com/SteveZhangBit/leiogo-css/node"
+	"github.com/SteveZhangBit/leiogo-css/xpath"
+)
+
+// XPath evaluates expr with every node of e as context node and returns the
+// union of the selected nodes in document order. Selected attributes are
+// returned as text nodes holding their values.
+func (e *Elements) XPath(expr string) *Elements {
+	if e.Err != nil {
+		return e
+	}
+	op := call("XPath", expr)
+	x, err := xpath.Compile(expr)
+	if err != nil {
+		return e.fail(op, fmt.Errorf("%w: %w", ErrSyntax, err))
+	}
+	nodes := []*node.Node{}
+	for _, n := range e.Nodes {
+		ns, err := x.Select(n)
+		if err != nil {
+			return e.fail(op, err)
+		}
+		nodes = append(nodes, ns...)
+	}
+	if len(e.Nodes) > 1 {
+		nodes = node.SortUnique(nodes)
+	}
+	return e.derive(op, nodes)
+}
+
+// XPathValue evaluates expr with the first node of e as context node. The
+// result is a []*node.Node, string, float64 or bool.
+func (e *Elements) XPathValue(expr string) (interface{}, error) {
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	op := call("XPathValue", expr)
+	if len(e.Nodes) == 0 {
+		return nil, e.wrap(op, ErrEmpty)
+	}
+	x, err := xpath.Compile(expr)
+	if err != nil {
+		return nil, e.wrap(op, fmt.Errorf("%w: %w", ErrSyntax, err))
+	}
+	v, err := x.Evaluate(e.Nodes[0])
+	if err != nil {
+		return nil, e.wrap(op, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,613 @@
+package xpath
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SteveZhangBit/leiogo-css/node"
+	"golang.org/x/net/html"
+)
+
+// ref is a node of the XPath data model: a tree node, or the attr-th
+// attribute of an element when attr >= 0.
+type ref struct {
+	n    *html.Node
+	attr int
+}
+
+type nodeSet []ref
+
+type value interface{}
+
+type context struct {
+	ref  ref
+	pos  int
+	size int
+}
+
+type evalError struct {
+	msg string
+}
+
+func (e *evalError) Error() string {
+	return "xpath: " + e.msg
+}
+
+func fail(format string, args ...interface{}) {
+	panic(&evalError{msg: fmt.Sprintf(format, args...)})
+}
+
+type expr interface {
+	eval(c *context) value
+}
+
+type literalExpr string
+
+func (e literalExpr) eval(c *context) value {
+	return string(e)
+}
+
+type numberExpr float64
+
+func (e numberExpr) eval(c *context) value {
+	return float64(e)
+}
+
+type negExpr struct {
+	e expr
+}
+
+func (e *negExpr) eval(c *context) value {
+	return -toNumber(e.e.eval(c))
+}
+
+type unionExpr struct {
+	l, r expr
+}
+
+func (e *unionExpr) eval(c *context) value {
+	l, r := e.l.eval(c), e.r.eval(c)
+	ls, ok1 := l.(nodeSet)
+	rs, ok2 := r.(nodeSet)
+	if !ok1 || !ok2 {
+		fail("operands of | must be node-sets")
+	}
+	return sortUnique(append(append(nodeSet{}, ls...), rs...))
+}
+
+type binaryExpr struct {
+	op   string
+	l, r expr
+}
+
+func (e *binaryExpr) eval(c *context) value {
+	switch e.op {
+	case "or":
+		return toBool(e.l.eval(c)) || toBool(e.r.eval(c))
+	case "and":
+		return toBool(e.l.eval(c)) && toBool(e.r.eval(c))
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compare(e.op, e.l.eval(c), e.r.eval(c))
+	}
+	l, r := toNumber(e.l.eval(c)), toNumber(e.r.eval(c))
+	switch e.op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "div":
+		return l / r
+	case "mod":
+		return math.Mod(l, r)
+	}
+	fail("unknown operator %s", e.op)
+	return nil
+}
+
+type callExpr struct {
+	name string
+	fn   function
+	args []expr
+}
+
+func (e *callExpr) eval(c *context) value {
+	args := make([]value, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.eval(c)
+	}
+	return e.fn.call(c, args)
+}
+
+type filterExpr struct {
+	e     expr
+	preds []expr
+}
+
+func (e *filterExpr) eval(c *context) value {
+	ns, ok := e.e.eval(c).(nodeSet)
+	if !ok {
+		fail("predicates can only filter node-sets")
+	}
+	for _, pred := range e.preds {
+		ns = filter(ns, pred)
+	}
+	return ns
+}
+
+type pathExpr struct {
+	filter expr
+	abs    bool
+	steps  []*step
+}
+
+func (e *pathExpr) eval(c *context) value {
+	var ns nodeSet
+	switch {
+	case e.filter != nil:
+		v, ok := e.filter.eval(c).(nodeSet)
+		if !ok {
+			fail("a location path can only follow a node-set")
+		}
+		ns = v
+	case e.abs:
+		ns = nodeSet{{n: root(c.ref.n), attr: -1}}
+	default:
+		ns = nodeSet{c.ref}
+	}
+	for _, s := range e.steps {
+		ns = s.apply(ns)
+	}
+	return ns
+}
+
+type axis int
+
+const (
+	axisAncestor axis = iota
+	axisAncestorOrSelf
+	axisAttribute
+	axisChild
+	axisDescendant
+	axisDescendantOrSelf
+	axisFollowing
+	axisFollowingSibling
+	axisNamespace
+	axisParent
+	axisPreceding
+	axisPrecedingSibling
+	axisSelf
+)
+
+var axes = map[string]axis{
+	"ancestor":           axisAncestor,
+	"ancestor-or-self":   axisAncestorOrSelf,
+	"attribute":          axisAttribute,
+	"child":              axisChild,
+	"descendant":         axisDescendant,
+	"descendant-or-self": axisDescendantOrSelf,
+	"following":          axisFollowing,
+	"following-sibling":  axisFollowingSibling,
+	"namespace":          axisNamespace,
+	"parent":             axisParent,
+	"preceding":          axisPreceding,
+	"preceding-sibling":  axisPrecedingSibling,
+	"self":               axisSelf,
+}
+
+func (a axis) reverse() bool {
+	switch a {
+	case axisAncestor, axisAncestorOrSelf, axisParent, axisPreceding, axisPrecedingSibling:
+		return true
+	}
+	return false
+}
+
+type testKind int
+
+const (
+	testName testKind = iota
+	testNode
+	testText
+	testComment
+	testPI
+)
+
+type nodeTest struct {
+	kind testKind
+	name string
+}
+
+func (t nodeTest) match(r ref, a axis) bool {
+	if r.attr >= 0 {
+		if t.kind == testNode {
+			return true
+		}
+		return t.kind == testName && a == axisAttribute && (t.name == "*" || nameMatch(t.name, r.n.Attr[r.attr].Namespace, r.n.Attr[r.attr].Key))
+	}
+	switch t.kind {
+	case testNode:
+		return true
+	case testText:
+		return r.n.Type == html.TextNode
+	case testComment:
+		return r.n.Type == html.CommentNode
+	case testName:
+		return a != axisAttribute && r.n.Type == html.ElementNode && (t.name == "*" || nameMatch(t.name, r.n.Namespace, r.n.Data))
+	}
+	return false
+}
+
+func nameMatch(test, ns, name string) bool {
+	if i := strings.IndexByte(test, ':'); i >= 0 {
+		return test[:i] == ns && (test[i+1:] == "*" || test[i+1:] == name)
+	}
+	return test == name
+}
+
+type step struct {
+	axis  axis
+	test  nodeTest
+	preds []expr
+}
+
+func (s *step) apply(in nodeSet) nodeSet {
+	var out nodeSet
+	for _, r := range in {
+		var ns nodeSet
+		s.walk(r, func(c ref) {
+			if s.test.match(c, s.axis) {
+				ns = append(ns, c)
+			}
+		})
+		for _, pred := range s.preds {
+			ns = filter(ns, pred)
+		}
+		out = append(out, ns...)
+	}
+	if len(in) > 1 {
+		return sortUnique(out)
+	}
+	if s.axis.reverse() {
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+	}
+	return out
+}
+
+// walk calls f for every node on the axis from r, in axis order.
+func (s *step) walk(r ref, f func(ref)) {
+	n := r.n
+	switch s.axis {
+	case axisSelf:
+		f(r)
+	case axisAttribute:
+		if r.attr < 0 && n.Type == html.ElementNode {
+			for i := range n.Attr {
+				f(ref{n: n, attr: i})
+			}
+		}
+	case axisChild:
+		if r.attr < 0 {
+			children(n, f)
+		}
+	case axisDescendantOrSelf:
+		f(r)
+		fallthrough
+	case axisDescendant:
+		if r.attr < 0 {
+			descendants(n, f)
+		}
+	case axisParent:
+		if r.attr >= 0 {
+			f(ref{n: n, attr: -1})
+		} else if n.Parent != nil {
+			f(ref{n: n.Parent, attr: -1})
+		}
+	case axisAncestorOrSelf:
+		f(r)
+		fallthrough
+	case axisAncestor:
+		if r.attr >= 0 {
+			f(ref{n: n, attr: -1})
+		}
+		for p := n.Parent; p != nil; p = p.Parent {
+			f(ref{n: p, attr: -1})
+		}
+	case axisFollowingSibling:
+		if r.attr < 0 {
+			for c := n.NextSibling; c != nil; c = c.NextSibling {
+				if isNode(c) {
+					f(ref{n: c, attr: -1})
+				}
+			}
+		}
+	case axisPrecedingSibling:
+		if r.attr < 0 {
+			for c := n.PrevSibling; c != nil; c = c.PrevSibling {
+				if isNode(c) {
+					f(ref{n: c, attr: -1})
+				}
+			}
+		}
+	case axisFollowing:
+		if r.attr >= 0 {
+			descendants(n, f)
+		}
+		for p := n; p != nil; p = p.Parent {
+			for c := p.NextSibling; c != nil; c = c.NextSibling {
+				if isNode(c) {
+					f(ref{n: c, attr: -1})
+					descendants(c, f)
+				}
+			}
+		}
+	case axisPreceding:
+		for p := n; p != nil; p = p.Parent {
+			for c := p.PrevSibling; c != nil; c = c.PrevSibling {
+				if isNode(c) {
+					reverseDescendants(c, f)
+					f(ref{n: c, attr: -1})
+				}
+			}
+		}
+	}
+}
+
+// isNode reports whether n is part of the XPath data model. Doctypes are
+// not.
+func isNode(n *html.Node) bool {
+	return n.Type != html.DoctypeNode
+}
+
+func children(n *html.Node, f func(ref)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if isNode(c) {
+			f(ref{n: c, attr: -1})
+		}
+	}
+}
+
+func descendants(n *html.Node, f func(ref)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if isNode(c) {
+			f(ref{n: c, attr: -1})
+			descendants(c, f)
+		}
+	}
+}
+
+func reverseDescendants(n *html.Node, f func(ref)) {
+	for c := n.LastChild; c != nil; c = c.PrevSibling {
+		if isNode(c) {
+			reverseDescendants(c, f)
+			f(ref{n: c, attr: -1})
+		}
+	}
+}
+
+func root(n *html.Node) *html.Node {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	return n
+}
+
+func filter(ns nodeSet, pred expr) nodeSet {
+	out := nodeSet{}
+	for i, r := range ns {
+		v := pred.eval(&context{ref: r, pos: i + 1, size: len(ns)})
+		if num, ok := v.(float64); ok {
+			if num == float64(i+1) {
+				out = append(out, r)
+			}
+		} else if toBool(v) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func compareRefs(a, b ref) int {
+	if a.n == b.n {
+		return a.attr - b.attr
+	}
+	return node.Compare((*node.Node)(a.n), (*node.Node)(b.n))
+}
+
+func sortUnique(ns nodeSet) nodeSet {
+	sort.SliceStable(ns, func(i, j int) bool {
+		return compareRefs(ns[i], ns[j]) < 0
+	})
+	out := ns[:0]
+	for i, r := range ns {
+		if i == 0 || r != ns[i-1] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func stringValue(r ref) string {
+	if r.attr >= 0 {
+		return r.n.Attr[r.attr].Val
+	}
+	switch r.n.Type {
+	case html.TextNode, html.CommentNode:
+		return r.n.Data
+	}
+	var b strings.Builder
+	descendants(r.n, func(c ref) {
+		if c.n.Type == html.TextNode {
+			b.WriteString(c.n.Data)
+		}
+	})
+	return b.String()
+}
+
+func toString(v value) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case bool:
+		if x {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return numberToString(x)
+	case nodeSet:
+		if len(x) == 0 {
+			return ""
+		}
+		return stringValue(x[0])
+	}
+	return ""
+}
+
+func numberToString(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func toNumber(v value) float64 {
+	switch x := v.(type) {
+	case float64:
+		return x
+	case bool:
+		if x {
+			return 1
+		}
+		return 0
+	}
+	return stringToNumber(toString(v))
+}
+
+func stringToNumber(s string) float64 {
+	s = strings.Trim(s, " \t\r\n")
+	digits, dot := 0, false
+	for i, c := range s {
+		switch {
+		case c == '-' && i == 0:
+		case c == '.' && !dot:
+			dot = true
+		case isDigit(c):
+			digits++
+		default:
+			return math.NaN()
+		}
+	}
+	if digits == 0 {
+		return math.NaN()
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+func toBool(v value) bool {
+	switch x := v.(type) {
+	case bool:
+		return x
+	case float64:
+		return x != 0 && !math.IsNaN(x)
+	case string:
+		return x != ""
+	case nodeSet:
+		return len(x) > 0
+	}
+	return false
+}
+
+func compare(op string, l, r value) bool {
+	ls, lok := l.(nodeSet)
+	rs, rok := r.(nodeSet)
+	switch {
+	case lok && rok:
+		for _, a := range ls {
+			for _, b := range rs {
+				if compareScalars(op, stringValue(a), stringValue(b)) {
+					return true
+				}
+			}
+		}
+		return false
+	case lok:
+		if _, ok := r.(bool); ok {
+			return compareScalars(op, toBool(l), r)
+		}
+		for _, a := range ls {
+			if compareScalars(op, atomize(stringValue(a), r), r) {
+				return true
+			}
+		}
+		return false
+	case rok:
+		if _, ok := l.(bool); ok {
+			return compareScalars(op, l, toBool(r))
+		}
+		for _, b := range rs {
+			if compareScalars(op, l, atomize(stringValue(b), l)) {
+				return true
+			}
+		}
+		return false
+	}
+	return compareScalars(op, l, r)
+}
+
+// atomize converts the string value of a node to the type of other, as
+// comparisons between node-sets and numbers compare numbers.
+func atomize(s string, other value) value {
+	if _, ok := other.(float64); ok {
+		return stringToNumber(s)
+	}
+	return s
+}
+
+func compareScalars(op string, l, r value) bool {
+	if op == "=" || op == "!=" {
+		var eq bool
+		_, lb := l.(bool)
+		_, rb := r.(bool)
+		_, ln := l.(float64)
+		_, rn := r.(float64)
+		switch {
+		case lb || rb:
+			eq = toBool(l) == toBool(r)
+		case ln || rn:
+			eq = toNumber(l) == toNumber(r)
+		default:
+			eq = toString(l) == toString(r)
+		}
+		return eq == (op == "=")
+	}
+	x, y := toNumber(l), toNumber(r)
+	switch op {
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">":
+		return x > y
+	case ">=":
+		return x >= y
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package xpath
+
+import (
+	"math"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// function is an entry of the XPath 1.0 core function library. max is -1
+// for functions taking any number of arguments.
+type function struct {
+	min, max int
+	call     func(c *context, args []value) value
+}
+
+var functions = map[string]function{
+	"last":             {0, 0, func(c *context, args []value) value { return float64(c.size) }},
+	"position":         {0, 0, func(c *context, args []value) value { return float64(c.pos) }},
+	"count":            {1, 1, func(c *context, args []value) value { return float64(len(nodeSetArg("count", args[0]))) }},
+	"id":               {1, 1, fnId},
+	"local-name":       {0, 1, fnLocalName},
+	"namespace-uri":    {0, 1, fnNamespaceURI},
+	"name":             {0, 1, fnName},
+	"string":           {0, 1, func(c *context, args []value) value { return toString(contextArg(c, args)) }},
+	"concat":           {2, -1, fnConcat},
+	"starts-with":      {2, 2, func(c *context, args []value) value { return strings.HasPrefix(toString(args[0]), toString(args[1])) }},
+	"contains":         {2, 2, func(c *context, args []value) value { return strings.Contains(toString(args[0]), toString(args[1])) }},
+	"substring-before": {2, 2, fnSubstringBefore},
+	"substring-after":  {2, 2, fnSubstringAfter},
+	"substring":        {2, 3, fnSubstring},
+	"string-length":    {0, 1, func(c *context, args []value) value { return float64(len([]rune(toString(contextArg(c, args))))) }},
+	"normalize-space":  {0, 1, func(c *context, args []value) value { return normalizeSpace(toString(contextArg(c, args))) }},
+	"translate":        {3, 3, fnTranslate},
+	"boolean":          {1, 1, func(c *context, args []value) value { return toBool(args[0]) }},
+	"not":              {1, 1, func(c *context, args []value) value { return !toBool(args[0]) }},
+	"true":             {0, 0, func(c *context, args []value) value { return true }},
+	"false":            {0, 0, func(c *context, args []value) value { return false }},
+	"lang":             {1, 1, fnLang},
+	"number":           {0, 1, func(c *context, args []value) value { return toNumber(contextArg(c, args)) }},
+	"sum":              {1, 1, fnSum},
+	"floor":            {1, 1, func(c *context, args []value) value { return math.Floor(toNumber(args[0])) }},
+	"ceiling":          {1, 1, func(c *context, args []value) value { return math.Ceil(toNumber(args[0])) }},
+	"round":            {1, 1, func(c *context, args []value) value { return round(toNumber(args[0])) }},
+}
+
+// contextArg returns the only argument, or the context node when the
+// argument was omitted.
+func contextArg(c *context, args []value) value {
+	if len(args) == 0 {
+		return nodeSet{c.ref}
+	}
+	return args[0]
+}
+
+func nodeSetArg(name string, v value) nodeSet {
+	ns, ok := v.(nodeSet)
+	if !ok {
+		fail("%s() needs a node-set", name)
+	}
+	return ns
+}
+
+func fnId(c *context, args []value) value {
+	var ids []string
+	if ns, ok := args[0].(nodeSet); ok {
+		for _, r := range ns {
+			ids = append(ids, strings.Fields(stringValue(r))...)
+		}
+	} else {
+		ids = strings.Fields(toString(args[0]))
+	}
+	want := map[string]bool{}
+	for _, id := range ids {
+		want[id] = true
+	}
+	out := nodeSet{}
+	descendants(root(c.ref.n), func(r ref) {
+		if r.n.Type != html.ElementNode {
+			return
+		}
+		for _, attr := range r.n.Attr {
+			if attr.Key == "id" && want[attr.Val] {
+				out = append(out, r)
+				delete(want, attr.Val)
+				return
+			}
+		}
+	})
+	return out
+}
+
+func firstArg(name string, c *context, args []value) (ref, bool) {
+	ns := nodeSetArg(name, contextArg(c, args))
+	if len(ns) == 0 {
+		return ref{}, false
+	}
+	return ns[0], true
+}
+
+func fnLocalName(c *context, args []value) value {
+	r, ok := firstArg("local-name", c, args)
+	if !ok {
+		return ""
+	}
+	if r.attr >= 0 {
+		return r.n.Attr[r.attr].Key
+	}
+	if r.n.Type == html.ElementNode {
+		return r.n.Data
+	}
+	return ""
+}
+
+func fnNamespaceURI(c *context, args []value) value {
+	r, ok := firstArg("namespace-uri", c, args)
+	if !ok {
+		return ""
+	}
+	if r.attr >= 0 {
+		return r.n.Attr[r.attr].Namespace
+	}
+	if r.n.Type == html.ElementNode {
+		return r.n.Namespace
+	}
+	return ""
+}
+
+func fnName(c *context, args []value) value {
+	r, ok := firstArg("name", c, args)
+	if !ok {
+		return ""
+	}
+	ns, local := "", ""
+	if r.attr >= 0 {
+		ns, local = r.n.Attr[r.attr].Namespace, r.n.Attr[r.attr].Key
+	} else if r.n.Type == html.ElementNode {
+		ns, local = r.n.Namespace, r.n.Data
+	}
+	if ns != "" {
+		return ns + ":" + local
+	}
+	return local
+}
+
+func fnConcat(c *context, args []value) value {
+	var b strings.Builder
+	for _, arg := range args {
+		b.WriteString(toString(arg))
+	}
+	return b.String()
+}
+
+func fnSubstringBefore(c *context, args []value) value {
+	s, sep := toString(args[0]), toString(args[1])
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i]
+	}
+	return ""
+}
+
+func fnSubstringAfter(c *context, args []value) value {
+	s, sep := toString(args[0]), toString(args[1])
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[i+len(sep):]
+	}
+	return ""
+}
+
+func fnSubstring(c *context, args []value) value {
+	s := []rune(toString(args[0]))
+	start, end := round(toNumber(args[1])), math.Inf(1)
+	if len(args) == 3 {
+		end = start + round(toNumber(args[2]))
+	}
+	var out []rune
+	for i, r := range s {
+		if p := float64(i + 1); p >= start && p < end {
+			out = append(out, r)
+		}
+	}
+	return string(out)
+}
+
+func normalizeSpace(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+	}), " ")
+}
+
+func fnTranslate(c *context, args []value) value {
+	s, from, to := toString(args[0]), []rune(toString(args[1])), []rune(toString(args[2]))
+	mapping := map[rune]rune{}
+	for i, r := range from {
+		if _, ok := mapping[r]; ok {
+			continue
+		}
+		if i < len(to) {
+			mapping[r] = to[i]
+		} else {
+			mapping[r] = -1
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		if m, ok := mapping[r]; ok {
+			return m
+		}
+		return r
+	}, s)
+}
+
+func fnLang(c *context, args []value) value {
+	lang := strings.ToLower(toString(args[0]))
+	n := c.ref.n
+	for ; n != nil; n = n.Parent {
+		for _, attr := range n.Attr {
+			if attr.Key == "lang" || attr.Key == "xml:lang" {
+				val := strings.ToLower(attr.Val)
+				return val == lang || strings.HasPrefix(val, lang+"-")
+			}
+		}
+	}
+	return false
+}
+
+func fnSum(c *context, args []value) value {
+	sum := 0.0
+	for _, r := range nodeSetArg("sum", args[0]) {
+		sum += stringToNumber(stringValue(r))
+	}
+	return sum
+}
+
+func round(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	return math.Floor(f + 0.5)
+}
@@ -0,0 +1,127 @@
+package xpath
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokOp
+	tokName
+	tokNumber
+	tokLiteral
+	tokVar
+)
+
+type token struct {
+	Type  tokenType
+	Value string
+	Num   float64
+	Pos   int
+}
+
+func (t token) String() string {
+	switch t.Type {
+	case tokEOF:
+		return "EOF"
+	case tokLiteral:
+		return strconv.Quote(t.Value)
+	case tokVar:
+		return "$" + t.Value
+	}
+	return t.Value
+}
+
+func isNameStart(c rune) bool {
+	return unicode.IsLetter(c) || c == '_'
+}
+
+func isNameChar(c rune) bool {
+	return isNameStart(c) || unicode.IsDigit(c) || c == '-' || c == '.' || unicode.Is(unicode.Mn, c)
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func tokenize(str string) ([]token, error) {
+	s := []rune(str)
+	tokens := []token{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			i++
+			continue
+		}
+		start := i
+		peek := func(j int) rune {
+			if i+j < len(s) {
+				return s[i+j]
+			}
+			return 0
+		}
+		switch {
+		case c == '"' || c == '\'':
+			i++
+			for i < len(s) && s[i] != c {
+				i++
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("xpath: unclosed literal at offset %d", start)
+			}
+			i++
+			tokens = append(tokens, token{Type: tokLiteral, Value: string(s[start+1 : i-1]), Pos: start})
+		case isDigit(c) || c == '.' && isDigit(peek(1)):
+			for i < len(s) && isDigit(s[i]) {
+				i++
+			}
+			if i < len(s) && s[i] == '.' {
+				i++
+				for i < len(s) && isDigit(s[i]) {
+					i++
+				}
+			}
+			num, _ := strconv.ParseFloat(string(s[start:i]), 64)
+			tokens = append(tokens, token{Type: tokNumber, Value: string(s[start:i]), Num: num, Pos: start})
+		case c == '$':
+			i++
+			for i < len(s) && (isNameChar(s[i]) || s[i] == ':') {
+				i++
+			}
+			tokens = append(tokens, token{Type: tokVar, Value: string(s[start+1 : i]), Pos: start})
+		case isNameStart(c):
+			for i < len(s) && isNameChar(s[i]) {
+				i++
+			}
+			// prefix:local and prefix:*, but not the axis separator ::
+			if i+1 < len(s) && s[i] == ':' && s[i+1] != ':' {
+				if s[i+1] == '*' {
+					i += 2
+				} else if isNameStart(s[i+1]) {
+					for i++; i < len(s) && isNameChar(s[i]); i++ {
+					}
+				}
+			}
+			tokens = append(tokens, token{Type: tokName, Value: string(s[start:i]), Pos: start})
+		default:
+			op := string(c)
+			switch two := string(c) + string(peek(1)); two {
+			case "..", "::", "//", "!=", "<=", ">=":
+				op = two
+			}
+			switch op {
+			case "(", ")", "[", "]", ".", "..", "@", ",", "::", "/", "//", "|",
+				"+", "-", "=", "!=", "<", "<=", ">", ">=", "*":
+			default:
+				return nil, fmt.Errorf("xpath: unexpected %q at offset %d", c, start)
+			}
+			i += len([]rune(op))
+			tokens = append(tokens, token{Type: tokOp, Value: op, Pos: start})
+		}
+	}
+	return append(tokens, token{Type: tokEOF, Pos: len(s)}), nil
+}
@@ -0,0 +1,329 @@
+package xpath
+
+import (
+	"fmt"
+)
+
+type syntaxError struct {
+	msg string
+	pos int
+}
+
+func (e *syntaxError) Error() string {
+	return fmt.Sprintf("xpath: %s at offset %d", e.msg, e.pos)
+}
+
+var nodeTypes = map[string]testKind{
+	"node":                   testNode,
+	"text":                   testText,
+	"comment":                testComment,
+	"processing-instruction": testPI,
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func parse(str string) (e expr, err error) {
+	tokens, err := tokenize(str)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	defer func() {
+		if r := recover(); r != nil {
+			if se, ok := r.(*syntaxError); ok {
+				e, err = nil, se
+				return
+			}
+			panic(r)
+		}
+	}()
+	e = p.or()
+	if t := p.peek(); t.Type != tokEOF {
+		p.fail("unexpected %s", t)
+	}
+	return e, nil
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(&syntaxError{msg: fmt.Sprintf(format, args...), pos: p.peek().Pos})
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) peekAt(j int) token {
+	if p.i+j < len(p.tokens) {
+		return p.tokens[p.i+j]
+	}
+	return p.tokens[len(p.tokens)-1]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.Type != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.Type == tokOp && t.Value == op
+}
+
+func (p *parser) isName(name string) bool {
+	t := p.peek()
+	return t.Type == tokName && t.Value == name
+}
+
+func (p *parser) expect(op string) {
+	if !p.isOp(op) {
+		p.fail("need %q, get %s", op, p.peek())
+	}
+	p.next()
+}
+
+func (p *parser) or() expr {
+	e := p.and()
+	for p.isName("or") {
+		p.next()
+		e = &binaryExpr{op: "or", l: e, r: p.and()}
+	}
+	return e
+}
+
+func (p *parser) and() expr {
+	e := p.equality()
+	for p.isName("and") {
+		p.next()
+		e = &binaryExpr{op: "and", l: e, r: p.equality()}
+	}
+	return e
+}
+
+func (p *parser) equality() expr {
+	e := p.relational()
+	for p.isOp("=") || p.isOp("!=") {
+		op := p.next().Value
+		e = &binaryExpr{op: op, l: e, r: p.relational()}
+	}
+	return e
+}
+
+func (p *parser) relational() expr {
+	e := p.additive()
+	for p.isOp("<") || p.isOp("<=") || p.isOp(">") || p.isOp(">=") {
+		op := p.next().Value
+		e = &binaryExpr{op: op, l: e, r: p.additive()}
+	}
+	return e
+}
+
+func (p *parser) additive() expr {
+	e := p.multiplicative()
+	for p.isOp("+") || p.isOp("-") {
+		op := p.next().Value
+		e = &binaryExpr{op: op, l: e, r: p.multiplicative()}
+	}
+	return e
+}
+
+func (p *parser) multiplicative() expr {
+	e := p.unary()
+	for p.isOp("*") || p.isName("div") || p.isName("mod") {
+		op := p.next().Value
+		e = &binaryExpr{op: op, l: e, r: p.unary()}
+	}
+	return e
+}
+
+func (p *parser) unary() expr {
+	if p.isOp("-") {
+		p.next()
+		return &negExpr{e: p.unary()}
+	}
+	return p.union()
+}
+
+func (p *parser) union() expr {
+	e := p.path()
+	for p.isOp("|") {
+		p.next()
+		e = &unionExpr{l: e, r: p.path()}
+	}
+	return e
+}
+
+func (p *parser) path() expr {
+	switch t := p.peek(); {
+	case t.Type == tokOp && t.Value == "/":
+		p.next()
+		path := &pathExpr{abs: true}
+		if p.startsStep() {
+			path.steps = p.steps()
+		}
+		return path
+	case t.Type == tokOp && t.Value == "//":
+		p.next()
+		return &pathExpr{abs: true, steps: append([]*step{descendantOrSelf()}, p.steps()...)}
+	case p.startsFilter():
+		e := p.primary()
+		if p.isOp("[") {
+			e = &filterExpr{e: e, preds: p.predicates()}
+		}
+		switch {
+		case p.isOp("/"):
+			p.next()
+			return &pathExpr{filter: e, steps: p.steps()}
+		case p.isOp("//"):
+			p.next()
+			return &pathExpr{filter: e, steps: append([]*step{descendantOrSelf()}, p.steps()...)}
+		}
+		return e
+	default:
+		return &pathExpr{steps: p.steps()}
+	}
+}
+
+func (p *parser) startsFilter() bool {
+	switch t := p.peek(); t.Type {
+	case tokLiteral, tokNumber, tokVar:
+		return true
+	case tokOp:
+		return t.Value == "("
+	case tokName:
+		_, isType := nodeTypes[t.Value]
+		next := p.peekAt(1)
+		return !isType && next.Type == tokOp && next.Value == "("
+	}
+	return false
+}
+
+func (p *parser) startsStep() bool {
+	switch t := p.peek(); t.Type {
+	case tokName:
+		return true
+	case tokOp:
+		return t.Value == "*" || t.Value == "." || t.Value == ".." || t.Value == "@"
+	}
+	return false
+}
+
+func (p *parser) steps() []*step {
+	steps := []*step{p.step()}
+	for {
+		switch {
+		case p.isOp("/"):
+			p.next()
+		case p.isOp("//"):
+			p.next()
+			steps = append(steps, descendantOrSelf())
+		default:
+			return steps
+		}
+		steps = append(steps, p.step())
+	}
+}
+
+func (p *parser) step() *step {
+	switch {
+	case p.isOp("."):
+		p.next()
+		return &step{axis: axisSelf, test: nodeTest{kind: testNode}}
+	case p.isOp(".."):
+		p.next()
+		return &step{axis: axisParent, test: nodeTest{kind: testNode}}
+	}
+
+	s := &step{axis: axisChild}
+	if p.isOp("@") {
+		p.next()
+		s.axis = axisAttribute
+	} else if t, next := p.peek(), p.peekAt(1); t.Type == tokName && next.Type == tokOp && next.Value == "::" {
+		axis, ok := axes[t.Value]
+		if !ok {
+			p.fail("unknown axis %s", t.Value)
+		}
+		p.next()
+		p.next()
+		s.axis = axis
+	}
+
+	switch t := p.peek(); {
+	case t.Type == tokOp && t.Value == "*":
+		p.next()
+		s.test = nodeTest{kind: testName, name: "*"}
+	case t.Type == tokName:
+		p.next()
+		if kind, ok := nodeTypes[t.Value]; ok && p.isOp("(") {
+			p.next()
+			s.test = nodeTest{kind: kind}
+			if kind == testPI && p.peek().Type == tokLiteral {
+				s.test.name = p.next().Value
+			}
+			p.expect(")")
+		} else {
+			s.test = nodeTest{kind: testName, name: t.Value}
+		}
+	default:
+		p.fail("need a node test, get %s", t)
+	}
+	s.preds = p.predicates()
+	return s
+}
+
+func (p *parser) predicates() []expr {
+	var preds []expr
+	for p.isOp("[") {
+		p.next()
+		preds = append(preds, p.or())
+		p.expect("]")
+	}
+	return preds
+}
+
+func (p *parser) primary() expr {
+	switch t := p.peek(); t.Type {
+	case tokLiteral:
+		p.next()
+		return literalExpr(t.Value)
+	case tokNumber:
+		p.next()
+		return numberExpr(t.Num)
+	case tokVar:
+		p.fail("variables are not supported")
+	case tokOp:
+		p.next()
+		e := p.or()
+		p.expect(")")
+		return e
+	}
+
+	t := p.next()
+	fn, ok := functions[t.Value]
+	if !ok {
+		panic(&syntaxError{msg: "unknown function " + t.Value, pos: t.Pos})
+	}
+	p.expect("(")
+	args := []expr{}
+	if !p.isOp(")") {
+		args = append(args, p.or())
+		for p.isOp(",") {
+			p.next()
+			args = append(args, p.or())
+		}
+	}
+	if len(args) < fn.min || fn.max >= 0 && len(args) > fn.max {
+		panic(&syntaxError{msg: "wrong number of arguments for " + t.Value + "()", pos: t.Pos})
+	}
+	p.expect(")")
+	return &callExpr{name: t.Value, fn: fn, args: args}
+}
+
+func descendantOrSelf() *step {
+	return &step{axis: axisDescendantOrSelf, test: nodeTest{kind: testNode}}
+}
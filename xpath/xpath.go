@@ -0,0 +1,82 @@
+// Package xpath implements XPath 1.0 over the trees of package node.
+//
+// Attributes are nodes of the XPath data model but not of the document
+// tree. When a node-set containing attributes is returned as []*node.Node,
+// every attribute becomes a node.AttrNode, which node.Compare and
+// node.SortUnique order and deduplicate by owner and attribute.
+//
+// Variables and the namespace axis are not supported.
+package xpath
+
+import (
+	"github.com/SteveZhangBit/leiogo-css/node"
+	"golang.org/x/net/html"
+)
+
+type Expr struct {
+	str string
+	e   expr
+}
+
+func Compile(str string) (*Expr, error) {
+	e, err := parse(str)
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{str: str, e: e}, nil
+}
+
+func MustCompile(str string) *Expr {
+	x, err := Compile(str)
+	if err != nil {
+		panic(err.Error())
+	}
+	return x
+}
+
+func (x *Expr) String() string {
+	return x.str
+}
+
+// Evaluate evaluates the expression with n as context node. The result is
+// a []*node.Node in document order, a string, a float64 or a bool.
+func (x *Expr) Evaluate(n *node.Node) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if ee, ok := r.(*evalError); ok {
+				result, err = nil, ee
+				return
+			}
+			panic(r)
+		}
+	}()
+	v := x.e.eval(&context{ref: ref{n: (*html.Node)(n), attr: -1}, pos: 1, size: 1})
+	if ns, ok := v.(nodeSet); ok {
+		return nodes(ns), nil
+	}
+	return v, nil
+}
+
+// Select evaluates an expression that returns a node-set.
+func (x *Expr) Select(n *node.Node) ([]*node.Node, error) {
+	v, err := x.Evaluate(n)
+	if err != nil {
+		return nil, err
+	}
+	if ns, ok := v.([]*node.Node); ok {
+		return ns, nil
+	}
+	return nil, &evalError{msg: x.str + " does not select a node-set"}
+}
+
+func nodes(ns nodeSet) []*node.Node {
+	out := make([]*node.Node, len(ns))
+	for i, r := range ns {
+		if r.attr >= 0 {
+			out[i] = node.AttrNode((*node.Node)(r.n), r.attr)
+		} else {
+			out[i] = (*node.Node)(r.n)
+		}
+	}
+	return out
+}
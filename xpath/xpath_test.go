@@ -0,0 +1,114 @@
+package xpath
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SteveZhangBit/leiogo-css/node"
+	"golang.org/x/net/html"
+)
+
+const page = `<html lang="en-US"><body>
+<div id="post" class="a b">
+	<h1>Title</h1>
+	<p class="x">one <b>bold</b></p>
+	<p>two</p>
+	<!-- note -->
+	<a href="/1">first</a><a href="/2">second</a>
+</div>
+<ul><li>3</li><li>4.5</li><li>x</li></ul>
+</body></html>`
+
+func doc(t *testing.T) *node.Node {
+	n, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return (*node.Node)(n)
+}
+
+func names(nodes []*node.Node) string {
+	s := []string{}
+	for _, n := range nodes {
+		if n.Type == html.ElementNode {
+			s = append(s, n.Data)
+		} else {
+			s = append(s, strings.TrimSpace(n.Data))
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+func TestSelect(t *testing.T) {
+	d := doc(t)
+	for expr, need := range map[string]string{
+		"//p":                                            "p p",
+		"//div[@id='post']/*[2]":                         "p",
+		"//p[last()]/text()":                             "two",
+		"//a/@href":                                      "/1 /2",
+		"//b/ancestor::*":                                "html body div p",
+		"//b/ancestor-or-self::*[@class][1]":             "p",
+		"//h1/following-sibling::p[1]":                   "p",
+		"//a[2]/preceding-sibling::*[1]":                 "a",
+		"//h1/following::li":                             "li li li",
+		"//li/preceding::h1":                             "h1",
+		"//div/comment()":                                "note",
+		"//a | //h1 | //a":                               "h1 a a",
+		"(//p | //li)[position() > 3]":                   "li li",
+		"id('post')/h1/..":                               "div",
+		"//*[contains(concat(' ', @class, ' '), ' b ')]": "div",
+		"//li[. > 4]":                                    "li",
+		"//p[b = 'bold']":                                "p",
+	} {
+		if nodes, err := MustCompile(expr).Select(d); err != nil || names(nodes) != need {
+			t.Errorf("%s: get %q, %v, need %q", expr, names(nodes), err, need)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	d := doc(t)
+	for expr, need := range map[string]interface{}{
+		"count(//p)":                      2.0,
+		"sum(//li[position() < 3])":       7.5,
+		"sum(//li)":                       "NaN",
+		"string(//a[2]/@href)":            "/2",
+		"normalize-space(//p[1])":         "one bold",
+		"substring('12345', 1.5, 2.6)":    "234",
+		"substring-after('a=b', '=')":     "b",
+		"translate('bar', 'abc', 'AB')":   "BAr",
+		"7 mod 3 + 10 div 4 * -1":         -1.5,
+		"//li = 3 and not(//li = 5)":      true,
+		"boolean(//b[lang('en')])":        true,
+		"name(//body/*[1])":               "div",
+		"string(round(2.5)) = '3'":        true,
+		"boolean(//table) or 1 > 2":       false,
+		"string-length(//h1)":             5.0,
+		"number('  -1.5 ') + number('x')": "NaN",
+	} {
+		v, err := MustCompile(expr).Evaluate(d)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+		} else if s, ok := need.(string); ok && s == "NaN" {
+			if toString(v) != "NaN" {
+				t.Errorf("%s: get %v, need NaN", expr, v)
+			}
+		} else if v != need {
+			t.Errorf("%s: get %v, need %v", expr, v, need)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, expr := range []string{"//a[", "foo()", "$x", "//a/", "child::", "unknown::a", "'abc"} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("%s: need a syntax error", expr)
+		}
+	}
+	if _, err := MustCompile("count(1)").Evaluate(doc(t)); err == nil {
+		t.Error("Need an error for count(1)")
+	}
+	if _, err := MustCompile("1 + 1").Select(doc(t)); err == nil {
+		t.Error("Need an error for Select of a number")
+	}
+}